@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strings"
 )
@@ -42,10 +43,14 @@ func CreateAllergy(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(apiError{Error: "JSON inválido. Envía {\"id\":\"...\"}"})
 		return
 	}
-	id, ok := PLCreate(predAllergies, body.ID)
-	if !ok {
-		w.WriteHeader(http.StatusConflict)
-		json.NewEncoder(w).Encode(apiError{Error: "La alergia ya existe"})
+	id, err := PLCreate(r.Context(), predAllergies, body.ID)
+	if err != nil {
+		if errors.Is(err, errKBExists) {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(apiError{Error: "La alergia ya existe"})
+			return
+		}
+		writeKBError(w, err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -65,9 +70,13 @@ func DeleteAllergy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	id := parts[2]
-	if !PLDelete(predAllergies, id) {
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(apiError{Error: "No existe la alergia"})
+	if _, err := KBDelete(r.Context(), predAllergies, id); err != nil {
+		if errors.Is(err, errKBNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(apiError{Error: "No existe la alergia"})
+			return
+		}
+		writeKBError(w, err)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
@@ -91,9 +100,9 @@ func UpdateAllergy(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(apiError{Error: "JSON inválido. Envía {\"id\":\"nuevo_id\"}"})
 		return
 	}
-	newID, ok, why := PLUpdate(predAllergies, oldID, body.ID)
-	if !ok {
-		switch why {
+	f, err := KBUpdate(r.Context(), predAllergies, []string{oldID}, []string{body.ID})
+	if err != nil {
+		switch kbWhy(err) {
 		case "not_found":
 			w.WriteHeader(http.StatusNotFound)
 			json.NewEncoder(w).Encode(apiError{Error: "No existe la alergia a actualizar"})
@@ -101,10 +110,10 @@ func UpdateAllergy(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusConflict)
 			json.NewEncoder(w).Encode(apiError{Error: "Ya existe una alergia con ese id"})
 		default:
-			http.Error(w, "Error", http.StatusInternalServerError)
+			writeKBError(w, err)
 		}
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(allergyDTO{ID: newID})
+	json.NewEncoder(w).Encode(allergyDTO{ID: f.Args[0]})
 }
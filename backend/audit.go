@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	auditCreate = "create"
+	auditUpdate = "update"
+	auditDelete = "delete"
+)
+
+// AuditEntry es una línea de {DATA_DIR}/audit.jsonl. Old falta en las altas
+// y New en las bajas; las entradas de una misma transacción comparten TxID,
+// así se ve qué borrados fueron cascada de otro.
+type AuditEntry struct {
+	Seq       int      `json:"seq"`
+	TxID      string   `json:"txId"`
+	KBVersion int      `json:"kbVersion"`
+	Time      string   `json:"time"`
+	Actor     string   `json:"actor"`
+	Action    string   `json:"action"`
+	Pred      string   `json:"pred"`
+	Old       []string `json:"old,omitempty"`
+	New       []string `json:"new,omitempty"`
+}
+
+var (
+	auditMu  sync.Mutex
+	auditSeq = -1 // -1: todavía no se leyó el último número del archivo
+)
+
+func auditFile() string {
+	return filepath.Join(dataDir(), "audit.jsonl")
+}
+
+func (tx *KBTx) record(action string, before, after *Fact) {
+	e := AuditEntry{Actor: tx.actor, Action: action}
+	if before != nil {
+		e.Pred, e.Old = before.Pred, before.Args
+	}
+	if after != nil {
+		e.Pred, e.New = after.Pred, after.Args
+	}
+	tx.audit = append(tx.audit, e)
+}
+
+// compactAudit resume lo que hizo una transacción. Varios handlers
+// reemplazan hechos borrando y volviendo a crear (p. ej. los síntomas de una
+// enfermedad): un alta idéntica a una baja previa se anula. Las
+// modificaciones solo salen de KBTx.Update, que registra el par explícito.
+func compactAudit(entries []AuditEntry) []AuditEntry {
+	var out []AuditEntry
+	for _, e := range entries {
+		if e.Action == auditCreate {
+			if i := findDeleted(out, e.Pred, e.New); i >= 0 {
+				out = append(out[:i], out[i+1:]...)
+				continue
+			}
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+func findDeleted(entries []AuditEntry, pred string, args []string) int {
+	for i, d := range entries {
+		if d.Action == auditDelete && d.Pred == pred && slices.Equal(d.Old, args) {
+			return i
+		}
+	}
+	return -1
+}
+
+// appendAudit agrega las entradas al final del archivo con un mismo TxID,
+// hora y la versión de la base que resultó. El archivo solo se abre en modo
+// O_APPEND: nada lo reescribe.
+func appendAudit(entries []AuditEntry, version int) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	if auditSeq < 0 {
+		all, err := readAudit()
+		if err != nil {
+			return err
+		}
+		auditSeq = 0
+		if len(all) > 0 {
+			auditSeq = all[len(all)-1].Seq
+		}
+	}
+	if err := os.MkdirAll(dataDir(), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(auditFile(), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	now := time.Now().UTC().Format(time.RFC3339)
+	txID := newRecordID("tx")
+	var buf []byte
+	seq := auditSeq
+	for _, e := range entries {
+		seq++
+		e.Seq, e.TxID, e.KBVersion, e.Time = seq, txID, version, now
+		line, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		buf = append(append(buf, line...), '\n')
+	}
+	if _, err := f.Write(buf); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	auditSeq = seq
+	return nil
+}
+
+func readAudit() ([]AuditEntry, error) {
+	f, err := os.Open(auditFile())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var out []AuditEntry
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		if len(strings.TrimSpace(sc.Text())) == 0 {
+			continue
+		}
+		var e AuditEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, sc.Err()
+}
+
+// parseAuditTime acepta RFC 3339 o solo la fecha; con fecha sola, end=true
+// toma el final de ese día.
+func parseAuditTime(s string, end bool) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, true
+	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return time.Time{}, false
+	}
+	if end {
+		t = t.Add(24*time.Hour - time.Second)
+	}
+	return t, true
+}
+
+// auditFilter responde a los parámetros de /api/audit: pred, entity (id que
+// aparece como argumento en la tupla anterior o nueva), actor, from y to.
+type auditFilter struct {
+	pred, entity, actor string
+	from, to            time.Time
+}
+
+func (af auditFilter) match(e AuditEntry) bool {
+	if af.pred != "" && e.Pred != af.pred {
+		return false
+	}
+	if af.actor != "" && e.Actor != af.actor {
+		return false
+	}
+	if af.entity != "" {
+		found := false
+		for _, a := range append(append([]string{}, e.Old...), e.New...) {
+			if a == af.entity {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	t, err := time.Parse(time.RFC3339, e.Time)
+	if err != nil {
+		return false
+	}
+	if !af.from.IsZero() && t.Before(af.from) {
+		return false
+	}
+	if !af.to.IsZero() && t.After(af.to) {
+		return false
+	}
+	return true
+}
+
+func ListAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(apiError{Error: "método no permitido"})
+		return
+	}
+	q := r.URL.Query()
+	af := auditFilter{actor: strings.ToLower(strings.TrimSpace(q.Get("actor")))}
+	if v := strings.TrimSpace(q.Get("pred")); v != "" {
+		af.pred = toAtom(v)
+	}
+	if v := strings.TrimSpace(q.Get("entity")); v != "" {
+		af.entity = toAtom(v)
+		if n, ok := normalizeNumber(v); ok {
+			af.entity = n
+		}
+	}
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+		end  bool
+	}{{"from", &af.from, false}, {"to", &af.to, true}} {
+		v := strings.TrimSpace(q.Get(p.name))
+		if v == "" {
+			continue
+		}
+		t, ok := parseAuditTime(v, p.end)
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(apiError{Error: p.name + " debe ser una fecha (2006-01-02) o RFC 3339"})
+			return
+		}
+		*p.dst = t
+	}
+	limit := 0
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(apiError{Error: "limit debe ser un entero positivo"})
+			return
+		}
+		limit = n
+	}
+
+	auditMu.Lock()
+	all, err := readAudit()
+	auditMu.Unlock()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(apiError{Error: err.Error()})
+		return
+	}
+	// las más recientes primero
+	out := []AuditEntry{}
+	for i := len(all) - 1; i >= 0; i-- {
+		if af.match(all[i]) {
+			out = append(out, all[i])
+			if limit > 0 && len(out) == limit {
+				break
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
@@ -0,0 +1,662 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Roles de menor a mayor: cada uno puede todo lo del anterior. roleAnonymous
+// marca las rutas públicas.
+const (
+	roleAnonymous = ""
+	roleReadOnly  = "lectura"
+	roleClinician = "clinico"
+	roleCurator   = "curador"
+	roleAdmin     = "admin"
+)
+
+var roleRank = map[string]int{roleAnonymous: 0, roleReadOnly: 1, roleClinician: 2, roleCurator: 3, roleAdmin: 4}
+
+const (
+	pbkdf2Iterations = 600000
+	sessionTTL       = 12 * time.Hour
+
+	// intentos fallidos de login tolerados dentro de loginWindow; por IP son
+	// más porque varias personas pueden salir por la misma dirección
+	loginMaxPerEmail = 5
+	loginMaxPerIP    = 20
+	loginWindow      = 15 * time.Minute
+
+	bootstrapPasswordEnv = "BOOTSTRAP_ADMIN_PASSWORD"
+)
+
+var (
+	errBadCredentials = errors.New("credenciales inválidas")
+	errLastAdmin      = errors.New("tiene que quedar al menos un administrador")
+)
+
+// dummyPasswordHash se compara cuando el email no existe, para que la
+// respuesta tarde lo mismo que con una contraseña equivocada.
+var dummyPasswordHash = sync.OnceValue(func() string {
+	h, _ := hashPassword("usuario-inexistente")
+	return h
+})
+
+// User es una cuenta del backend; PasswordHash nunca sale en las respuestas.
+type User struct {
+	Email        string `json:"email"`
+	Role         string `json:"role"`
+	PasswordHash string `json:"passwordHash,omitempty"`
+	CreatedAt    string `json:"createdAt"`
+}
+
+// Session es un token emitido por /api/auth/login. Vive solo en memoria: al
+// reiniciar el servidor hay que volver a entrar.
+type Session struct {
+	Token     string `json:"token"`
+	Email     string `json:"email"`
+	Role      string `json:"role"`
+	ExpiresAt string `json:"expiresAt"`
+	expires   time.Time
+}
+
+// userStore guarda las cuentas en {DATA_DIR}/users.json.
+type userStore struct {
+	mu       sync.Mutex
+	file     string
+	users    map[string]User
+	sessions map[string]Session
+}
+
+var users *userStore
+
+func InitAuth() error {
+	var err error
+	users, err = openUserStore(filepath.Join(dataDir(), "users.json"))
+	// se calcula ya para que el primer login con un email desconocido no
+	// tarde más que los siguientes
+	dummyPasswordHash()
+	return err
+}
+
+func openUserStore(file string) (*userStore, error) {
+	s := &userStore{file: file, users: map[string]User{}, sessions: map[string]Session{}}
+	data, err := os.ReadFile(file)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return s, nil
+	case err != nil:
+		return nil, err
+	}
+	var list []User
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	for _, u := range list {
+		s.users[u.Email] = u
+	}
+	return s, nil
+}
+
+func (s *userStore) save() error {
+	list := make([]User, 0, len(s.users))
+	for _, k := range sortedKeys(s.users) {
+		list = append(list, s.users[k])
+	}
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.file), 0o755); err != nil {
+		return err
+	}
+	return writeFileAtomic(s.file, data)
+}
+
+// hashPassword devuelve "pbkdf2-sha256$iteraciones$sal$clave" en base64.
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, pbkdf2Iterations, 32)
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawStdEncoding
+	return "pbkdf2-sha256$" + strconv.Itoa(pbkdf2Iterations) + "$" + enc.EncodeToString(salt) + "$" + enc.EncodeToString(key), nil
+}
+
+func checkPassword(hash, password string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2-sha256" {
+		return false
+	}
+	iter, err := strconv.Atoi(parts[1])
+	if err != nil || iter <= 0 {
+		return false
+	}
+	enc := base64.RawStdEncoding
+	salt, err1 := enc.DecodeString(parts[2])
+	want, err2 := enc.DecodeString(parts[3])
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	got, err := pbkdf2.Key(sha256.New, password, salt, iter, len(want))
+	return err == nil && subtle.ConstantTimeCompare(got, want) == 1
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func validUserRole(role string) bool {
+	return role != roleAnonymous && roleRank[role] > 0
+}
+
+func (s *userStore) List() []User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]User, 0, len(s.users))
+	for _, k := range sortedKeys(s.users) {
+		u := s.users[k]
+		u.PasswordHash = ""
+		out = append(out, u)
+	}
+	return out
+}
+
+func (s *userStore) HasRole(role string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if u.Role == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Put crea (create=true) o modifica una cuenta. password vacío conserva la
+// contraseña actual; role vacío conserva el rol.
+func (s *userStore) Put(email, password, role string, create bool) (User, error) {
+	email = normalizeEmail(email)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, exists := s.users[email]
+	switch {
+	case create && exists:
+		return User{}, errKBExists
+	case !create && !exists:
+		return User{}, errRecordNotFound
+	}
+	if create {
+		u = User{Email: email, CreatedAt: time.Now().UTC().Format(time.RFC3339)}
+	}
+	if role != "" {
+		if u.Role == roleAdmin && role != roleAdmin && s.admins() == 1 {
+			return User{}, errLastAdmin
+		}
+		u.Role = role
+	}
+	if password != "" {
+		h, err := hashPassword(password)
+		if err != nil {
+			return User{}, err
+		}
+		u.PasswordHash = h
+	}
+	s.users[email] = u
+	if err := s.save(); err != nil {
+		return User{}, err
+	}
+	// un cambio de rol o contraseña invalida las sesiones abiertas
+	for tok, sess := range s.sessions {
+		if sess.Email == email {
+			delete(s.sessions, tok)
+		}
+	}
+	u.PasswordHash = ""
+	return u, nil
+}
+
+func (s *userStore) Delete(email string) error {
+	email = normalizeEmail(email)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[email]
+	if !ok {
+		return errRecordNotFound
+	}
+	if u.Role == roleAdmin && s.admins() == 1 {
+		return errLastAdmin
+	}
+	delete(s.users, email)
+	for tok, sess := range s.sessions {
+		if sess.Email == email {
+			delete(s.sessions, tok)
+		}
+	}
+	return s.save()
+}
+
+// admins cuenta las cuentas con rol admin; se llama con s.mu tomado.
+func (s *userStore) admins() int {
+	n := 0
+	for _, u := range s.users {
+		if u.Role == roleAdmin {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *userStore) Login(email, password string) (Session, error) {
+	email = normalizeEmail(email)
+	s.mu.Lock()
+	u, ok := s.users[email]
+	s.mu.Unlock()
+	hash := u.PasswordHash
+	if !ok {
+		hash = dummyPasswordHash()
+	}
+	if !checkPassword(hash, password) || !ok {
+		return Session{}, errBadCredentials
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return Session{}, err
+	}
+	exp := time.Now().Add(sessionTTL)
+	sess := Session{Token: hex.EncodeToString(b), Email: u.Email, Role: u.Role, ExpiresAt: exp.UTC().Format(time.RFC3339), expires: exp}
+	s.mu.Lock()
+	s.sessions[sess.Token] = sess
+	s.mu.Unlock()
+	return sess, nil
+}
+
+func (s *userStore) Session(token string) (Session, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.sessions[token]
+	if ok && time.Now().After(sess.expires) {
+		delete(s.sessions, token)
+		return Session{}, false
+	}
+	return sess, ok
+}
+
+func (s *userStore) Logout(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, token)
+}
+
+type ctxKey int
+
+const ctxSession ctxKey = iota
+
+func bearerToken(r *http.Request) string {
+	h := r.Header.Get("Authorization")
+	if len(h) > 7 && strings.EqualFold(h[:7], "bearer ") {
+		return strings.TrimSpace(h[7:])
+	}
+	return ""
+}
+
+// sessionOf devuelve la sesión que withRoles dejó en el contexto.
+func sessionOf(r *http.Request) (Session, bool) {
+	sess, ok := r.Context().Value(ctxSession).(Session)
+	return sess, ok
+}
+
+// actorOf identifica a quién atribuir un cambio: el email de la sesión o
+// "anonimo" si el contexto no trae ninguna.
+func actorOf(ctx context.Context) string {
+	if ctx != nil {
+		if sess, ok := ctx.Value(ctxSession).(Session); ok {
+			return sess.Email
+		}
+	}
+	return "anonimo"
+}
+
+func hasRole(r *http.Request, role string) bool {
+	return ctxHasRole(r.Context(), role)
+}
+
+// ctxHasRole es hasRole para código que solo recibe el contexto del pedido.
+func ctxHasRole(ctx context.Context, role string) bool {
+	if role == roleAnonymous {
+		return true
+	}
+	sess, ok := ctx.Value(ctxSession).(Session)
+	return ok && roleRank[sess.Role] >= roleRank[role]
+}
+
+// withRoles exige readRole para GET y writeRole para el resto de los
+// métodos. Si el pedido trae un token válido la sesión queda en el contexto
+// aunque la ruta sea pública.
+func withRoles(readRole, writeRole string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if tok := bearerToken(r); tok != "" && users != nil {
+			if sess, ok := users.Session(tok); ok {
+				r = r.WithContext(context.WithValue(r.Context(), ctxSession, sess))
+			}
+		}
+		need := writeRole
+		if r.Method == http.MethodGet {
+			need = readRole
+		}
+		if !hasRole(r, need) {
+			if _, ok := sessionOf(r); !ok {
+				w.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(w).Encode(apiError{Error: "necesitas iniciar sesión"})
+				return
+			}
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(apiError{Error: "tu rol no tiene permiso para esta operación"})
+			return
+		}
+		next(w, r)
+	}
+}
+
+// loginThrottle cuenta los logins fallidos por clave (email o IP). Al llegar
+// al máximo la clave queda bloqueada hasta que vence la ventana que abrió el
+// primer fallo.
+type loginThrottle struct {
+	mu    sync.Mutex
+	fails map[string]loginFails
+}
+
+type loginFails struct {
+	n     int
+	since time.Time
+}
+
+type throttleKey struct {
+	key string
+	max int
+}
+
+var loginLimiter = &loginThrottle{fails: map[string]loginFails{}}
+
+// wait devuelve cuánto falta para poder volver a intentar; 0 si ninguna
+// clave está bloqueada.
+func (t *loginThrottle) wait(keys []throttleKey, now time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var d time.Duration
+	for _, k := range keys {
+		f, ok := t.fails[k.key]
+		if !ok {
+			continue
+		}
+		left := f.since.Add(loginWindow).Sub(now)
+		if left <= 0 {
+			delete(t.fails, k.key)
+			continue
+		}
+		if f.n >= k.max && left > d {
+			d = left
+		}
+	}
+	return d
+}
+
+func (t *loginThrottle) fail(keys []throttleKey, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	// se aprovecha para descartar las ventanas vencidas
+	for k, f := range t.fails {
+		if now.Sub(f.since) >= loginWindow {
+			delete(t.fails, k)
+		}
+	}
+	for _, k := range keys {
+		f, ok := t.fails[k.key]
+		if !ok {
+			f.since = now
+		}
+		f.n++
+		t.fails[k.key] = f
+	}
+}
+
+func (t *loginThrottle) reset(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.fails, key)
+}
+
+// clientIP es la dirección de la conexión. No se confía en
+// X-Forwarded-For: cualquiera puede mandarlo.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+type loginIn struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+func handleLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(apiError{Error: "método no permitido"})
+		return
+	}
+	var in loginIn
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(apiError{Error: "JSON inválido"})
+		return
+	}
+	emailKey := "email:" + normalizeEmail(in.Email)
+	keys := []throttleKey{{emailKey, loginMaxPerEmail}, {"ip:" + clientIP(r), loginMaxPerIP}}
+	if d := loginLimiter.wait(keys, time.Now()); d > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(d.Seconds())+1))
+		w.WriteHeader(http.StatusTooManyRequests)
+		json.NewEncoder(w).Encode(apiError{Error: "demasiados intentos fallidos; vuelve a intentar más tarde"})
+		return
+	}
+	sess, err := users.Login(in.Email, in.Password)
+	if err != nil {
+		if errors.Is(err, errBadCredentials) {
+			loginLimiter.fail(keys, time.Now())
+			w.WriteHeader(http.StatusUnauthorized)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		json.NewEncoder(w).Encode(apiError{Error: err.Error()})
+		return
+	}
+	loginLimiter.reset(emailKey)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sess)
+}
+
+func handleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(apiError{Error: "método no permitido"})
+		return
+	}
+	users.Logout(bearerToken(r))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handleMe(w http.ResponseWriter, r *http.Request) {
+	sess, _ := sessionOf(r)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sess)
+}
+
+type userIn struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Role     string `json:"role"`
+}
+
+func ListUsers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(users.List())
+}
+
+func CreateUser(w http.ResponseWriter, r *http.Request) {
+	var in userIn
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(apiError{Error: "JSON inválido"})
+		return
+	}
+	if normalizeEmail(in.Email) == "" || len(in.Password) < 8 || !validUserRole(in.Role) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(apiError{Error: "email, password (mínimo 8 caracteres) y role (" + strings.Join(userRoles(), ", ") + ") son obligatorios"})
+		return
+	}
+	u, err := users.Put(in.Email, in.Password, in.Role, true)
+	if err != nil {
+		if errors.Is(err, errKBExists) {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(apiError{Error: "el usuario ya existe"})
+			return
+		}
+		writeRecordError(w, err, "")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(u)
+}
+
+// handleUser atiende PUT/PATCH y DELETE en /api/users/{email}.
+func handleUser(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) != 3 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(apiError{Error: "ruta: /api/users/{email}"})
+		return
+	}
+	email := normalizeEmail(parts[2])
+	switch r.Method {
+	case http.MethodPut, http.MethodPatch:
+		var in userIn
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(apiError{Error: "JSON inválido"})
+			return
+		}
+		if (in.Role != "" && !validUserRole(in.Role)) || (in.Password != "" && len(in.Password) < 8) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(apiError{Error: "role debe ser " + strings.Join(userRoles(), ", ") + " y password tener al menos 8 caracteres"})
+			return
+		}
+		u, err := users.Put(email, in.Password, in.Role, false)
+		if err != nil {
+			writeUserError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(u)
+	case http.MethodDelete:
+		if sess, _ := sessionOf(r); sess.Email == email {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(apiError{Error: "no puedes borrar tu propia cuenta"})
+			return
+		}
+		if err := users.Delete(email); err != nil {
+			writeUserError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(apiError{Error: "método no permitido"})
+	}
+}
+
+func writeUserError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errLastAdmin) {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(apiError{Error: err.Error()})
+		return
+	}
+	writeRecordError(w, err, "no existe el usuario")
+}
+
+func userRoles() []string {
+	roles := []string{}
+	for r := range roleRank {
+		if r != roleAnonymous {
+			roles = append(roles, r)
+		}
+	}
+	sort.Slice(roles, func(i, j int) bool { return roleRank[roles[i]] < roleRank[roles[j]] })
+	return roles
+}
+
+// runBootstrapAdminCLI crea el primer administrador. Se niega si ya hay uno:
+// los siguientes se crean desde /api/users. La contraseña no va en los
+// argumentos (quedaría en el historial y en la lista de procesos): sale de
+// BOOTSTRAP_ADMIN_PASSWORD o de la primera línea de stdin.
+func runBootstrapAdminCLI(args []string, stdin io.Reader, stdout io.Writer) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "uso: backend bootstrap-admin email  (contraseña por stdin o "+bootstrapPasswordEnv+")")
+		return 2
+	}
+	password, ok := os.LookupEnv(bootstrapPasswordEnv)
+	if !ok {
+		fmt.Fprint(os.Stderr, "contraseña: ")
+		line, err := bufio.NewReader(stdin).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+	if len(password) < 8 {
+		fmt.Fprintln(os.Stderr, "la contraseña debe tener al menos 8 caracteres")
+		return 2
+	}
+	if err := InitAuth(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if users.HasRole(roleAdmin) {
+		fmt.Fprintln(os.Stderr, "ya existe un administrador; usa /api/users")
+		return 1
+	}
+	u, err := users.Put(args[0], password, roleAdmin, true)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Fprintln(stdout, "administrador creado:", u.Email)
+	return 0
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestLoginThrottle recorre la ventana de intentos fallidos por email y por IP.
+func TestLoginThrottle(t *testing.T) {
+	t0 := time.Date(2025, 1, 2, 3, 0, 0, 0, time.UTC)
+	email := throttleKey{"email:a@x.com", loginMaxPerEmail}
+	ip := throttleKey{"ip:10.0.0.1", loginMaxPerIP}
+	tests := []struct {
+		name  string
+		fails int
+		keys  func(i int) []throttleKey
+		reset string
+		at    time.Duration
+		want  time.Duration
+	}{
+		{
+			name:  "por debajo del máximo no espera",
+			fails: loginMaxPerEmail - 1,
+			keys:  func(int) []throttleKey { return []throttleKey{email, ip} },
+			want:  0,
+		},
+		{
+			name:  "al llegar al máximo espera hasta que vence la ventana",
+			fails: loginMaxPerEmail,
+			keys:  func(int) []throttleKey { return []throttleKey{email, ip} },
+			at:    time.Minute,
+			want:  loginWindow - time.Minute,
+		},
+		{
+			name:  "vencida la ventana se puede volver a intentar",
+			fails: loginMaxPerEmail,
+			keys:  func(int) []throttleKey { return []throttleKey{email, ip} },
+			at:    loginWindow,
+			want:  0,
+		},
+		{
+			name:  "un login correcto libera el email pero no la IP",
+			fails: loginMaxPerIP,
+			keys: func(i int) []throttleKey {
+				if i < loginMaxPerEmail {
+					return []throttleKey{email, ip}
+				}
+				return []throttleKey{ip}
+			},
+			reset: email.key,
+			want:  loginWindow,
+		},
+		{
+			name:  "muchos emails desde una IP la bloquean",
+			fails: loginMaxPerIP,
+			keys: func(i int) []throttleKey {
+				return []throttleKey{{"email:" + strings.Repeat("a", i+1) + "@x.com", loginMaxPerEmail}, ip}
+			},
+			want: loginWindow,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lt := &loginThrottle{fails: map[string]loginFails{}}
+			for i := range tt.fails {
+				lt.fail(tt.keys(i), t0)
+			}
+			if tt.reset != "" {
+				lt.reset(tt.reset)
+			}
+			if got := lt.wait([]throttleKey{email, ip}, t0.Add(tt.at)); got != tt.want {
+				t.Errorf("espera = %v, se esperaba %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestLoginTooManyRequests comprueba que handleLogin responda 429 con
+// Retry-After tras loginMaxPerEmail fallos.
+func TestLoginTooManyRequests(t *testing.T) {
+	saved := loginLimiter
+	loginLimiter = &loginThrottle{fails: map[string]loginFails{}}
+	t.Cleanup(func() { loginLimiter = saved })
+
+	body := `{"email":"nadie@x.com","password":"mala"}`
+	for i := 0; i <= loginMaxPerEmail; i++ {
+		rec := httptest.NewRecorder()
+		handleLogin(rec, httptest.NewRequest(http.MethodPost, "/api/auth/login", strings.NewReader(body)))
+		want := http.StatusUnauthorized
+		if i == loginMaxPerEmail {
+			want = http.StatusTooManyRequests
+		}
+		if rec.Code != want {
+			t.Fatalf("intento %d: código %d, se esperaba %d", i+1, rec.Code, want)
+		}
+		if want == http.StatusTooManyRequests && rec.Header().Get("Retry-After") == "" {
+			t.Error("falta Retry-After")
+		}
+	}
+}
+
+// TestWithRoles comprueba el rol que exige cada método y la diferencia entre
+// 401 (sin sesión) y 403 (rol insuficiente).
+func TestWithRoles(t *testing.T) {
+	sessions := map[string]string{}
+	for _, role := range []string{roleReadOnly, roleClinician, roleCurator, roleAdmin} {
+		tok := "token-" + role
+		users.mu.Lock()
+		users.sessions[tok] = Session{Token: tok, Email: role + "@x.com", Role: role, expires: time.Now().Add(time.Hour)}
+		users.mu.Unlock()
+		sessions[role] = tok
+	}
+	t.Cleanup(func() {
+		for _, tok := range sessions {
+			users.Logout(tok)
+		}
+	})
+
+	tests := []struct {
+		name        string
+		read, write string
+		method      string
+		role        string
+		want        int
+	}{
+		{"catálogo público sin sesión", roleAnonymous, roleCurator, http.MethodGet, "", http.StatusOK},
+		{"escribir sin sesión", roleAnonymous, roleCurator, http.MethodPost, "", http.StatusUnauthorized},
+		{"escribir con rol insuficiente", roleAnonymous, roleCurator, http.MethodPost, roleClinician, http.StatusForbidden},
+		{"escribir como curador", roleAnonymous, roleCurator, http.MethodDelete, roleCurator, http.StatusOK},
+		{"un rol mayor incluye a los menores", roleClinician, roleClinician, http.MethodGet, roleAdmin, http.StatusOK},
+		{"leer con rol insuficiente", roleClinician, roleClinician, http.MethodGet, roleReadOnly, http.StatusForbidden},
+		{"token desconocido cuenta como sin sesión", roleReadOnly, roleReadOnly, http.MethodGet, "desconocido", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := withRoles(tt.read, tt.write, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			req := httptest.NewRequest(tt.method, "/api/prueba", nil)
+			if tt.role != "" {
+				tok, ok := sessions[tt.role]
+				if !ok {
+					tok = tt.role
+				}
+				req.Header.Set("Authorization", "Bearer "+tok)
+			}
+			rec := httptest.NewRecorder()
+			h(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("código %d, se esperaba %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
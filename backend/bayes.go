@@ -0,0 +1,82 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	predPrior       = "prevalencia"
+	predSensitivity = "sensibilidad"
+	fileBayes       = "prolog.pl"
+
+	modeWeighted = "ponderado"
+	modeBayes    = "bayes"
+)
+
+// prevalencia(Enf, P) es la probabilidad previa de la enfermedad y
+// sensibilidad(Enf, Sint, Se, Sp) la sensibilidad y especificidad del síntoma
+// para ella. Las reglas conjunta_bayes/4 y detalle_hallazgo/6 están en
+// prolog.pl.
+var schemaSensitivity = []ArgType{ArgAtom, ArgAtom, ArgNumber, ArgNumber}
+
+func InitBayes() error {
+	if err := KBRegister(PredSchema{Name: predPrior, Types: []ArgType{ArgAtom, ArgNumber}}, fileBayes); err != nil {
+		return err
+	}
+	return KBRegister(PredSchema{Name: predSensitivity, Types: schemaSensitivity}, fileBayes)
+}
+
+// diagnosisMode normaliza el campo mode; devuelve "" si no es válido.
+func diagnosisMode(mode string) string {
+	switch strings.ToLower(strings.TrimSpace(mode)) {
+	case "", modeWeighted:
+		return modeWeighted
+	case modeBayes:
+		return modeBayes
+	}
+	return ""
+}
+
+// findingTerms arma [h(Sint, presente|ausente),...] para conjunta_bayes/4.
+func findingTerms(present []DxSymptom, denied []string) string {
+	items := make([]string, 0, len(present)+len(denied))
+	for _, s := range present {
+		items = append(items, "h("+plAtom(toAtom(s.ID))+",presente)")
+	}
+	for _, s := range denied {
+		items = append(items, "h("+plAtom(toAtom(s))+",ausente)")
+	}
+	return "[" + strings.Join(items, ",") + "]"
+}
+
+// scoreBayes devuelve prior × Π P(hallazgo|enfermedad) × modificadores, la
+// probabilidad conjunta de la enfermedad y los hallazgos; runDiagnosis la
+// divide por la suma de todas para obtener la posterior. Cada hallazgo se
+// informa con su estado, su verosimilitud y, si hay sensibilidad y
+// especificidad cargadas, su razón de verosimilitud; Contribution es el
+// logaritmo de la verosimilitud, su término en el logaritmo de la conjunta.
+func scoreBayes(kb kbView, eID, findings, profile string) (float64, []DxContribution, []DxRule) {
+	var contribs []DxContribution
+	var rules []DxRule
+	joint := 0.0
+	if sols := kb.ProveAll("conjunta_bayes(" + plAtom(eID) + "," + findings + "," + profile + ",J)."); len(sols) > 0 {
+		joint = plNumberOf(sols[0].ByName_("J"))
+	}
+	if sols := kb.ProveAll("prior(" + plAtom(eID) + ",P)."); len(sols) > 0 {
+		rules = append(rules, DxRule{Rule: "prevalencia/2", Details: eID + "," + strconv.FormatFloat(plNumberOf(sols[0].ByName_("P")), 'g', -1, 64)})
+	}
+	for _, s := range kb.ProveAll("detalle_hallazgo(" + plAtom(eID) + "," + findings + ",S,Estado,L,LR).") {
+		sid, state := plAtomOf(s.ByName_("S")), plAtomOf(s.ByName_("Estado"))
+		l, lr := plNumberOf(s.ByName_("L")), plNumberOf(s.ByName_("LR"))
+		contribs = append(contribs, DxContribution{SymptomID: sid, State: state, Likelihood: round2dx(l), LikelihoodRatio: round2dx(lr), Contribution: round2dx(math.Log(l))})
+		if lr > 0 {
+			rules = append(rules, DxRule{Rule: "sensibilidad/4", Details: eID + "," + sid + "," + state + ",LR " + strconv.FormatFloat(round2dx(lr), 'g', -1, 64)})
+		}
+	}
+	for _, s := range kb.ProveAll("modificador_aplicado(" + plAtom(eID) + "," + profile + ",Cond,F).") {
+		rules = append(rules, DxRule{Rule: "modificador/3", Details: eID + "," + plAtomOf(s.ByName_("Cond")) + ",x" + strconv.FormatFloat(plNumberOf(s.ByName_("F")), 'g', -1, 64)})
+	}
+	return joint, contribs, rules
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strings"
 )
@@ -42,10 +43,14 @@ func CreateChronic(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(apiError{Error: "JSON inválido. Envía {\"id\":\"...\"}"})
 		return
 	}
-	id, ok := PLCreate(predChronics, body.ID)
-	if !ok {
-		w.WriteHeader(http.StatusConflict)
-		json.NewEncoder(w).Encode(apiError{Error: "La crónica ya existe"})
+	id, err := PLCreate(r.Context(), predChronics, body.ID)
+	if err != nil {
+		if errors.Is(err, errKBExists) {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(apiError{Error: "La crónica ya existe"})
+			return
+		}
+		writeKBError(w, err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -65,9 +70,13 @@ func DeleteChronic(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	id := parts[2]
-	if !PLDelete(predChronics, id) {
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(apiError{Error: "No existe la crónica"})
+	if _, err := KBDelete(r.Context(), predChronics, id); err != nil {
+		if errors.Is(err, errKBNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(apiError{Error: "No existe la crónica"})
+			return
+		}
+		writeKBError(w, err)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
@@ -91,9 +100,9 @@ func UpdateChronic(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(apiError{Error: "JSON inválido. Envía {\"id\":\"nuevo_id\"}"})
 		return
 	}
-	newID, ok, why := PLUpdate(predChronics, oldID, body.ID)
-	if !ok {
-		switch why {
+	f, err := KBUpdate(r.Context(), predChronics, []string{oldID}, []string{body.ID})
+	if err != nil {
+		switch kbWhy(err) {
 		case "not_found":
 			w.WriteHeader(http.StatusNotFound)
 			json.NewEncoder(w).Encode(apiError{Error: "No existe la crónica a actualizar"})
@@ -101,10 +110,10 @@ func UpdateChronic(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusConflict)
 			json.NewEncoder(w).Encode(apiError{Error: "Ya existe una crónica con ese id"})
 		default:
-			http.Error(w, "Error", http.StatusInternalServerError)
+			writeKBError(w, err)
 		}
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(chronicDTO{ID: newID})
+	json.NewEncoder(w).Encode(chronicDTO{ID: f.Args[0]})
 }
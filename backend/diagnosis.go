@@ -1,33 +1,66 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"math"
 	"net/http"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
-)
 
-const predTrata = "trata"
+	"github.com/mndrix/golog/term"
+)
 
 type DxSymptom struct {
-	ID       string `json:"id"`
-	Severity string `json:"severity"`
+	ID           string   `json:"id"`
+	Severity     string   `json:"severity"`
+	Onset        string   `json:"onset,omitempty"`
+	DurationDays *float64 `json:"durationDays,omitempty"`
+	Intensity    *float64 `json:"intensity,omitempty"`
 }
 
 type DiagnosisIn struct {
-	Symptoms []DxSymptom `json:"symptoms"`
-	Allergies []string   `json:"allergies"`
-	Chronics  []string   `json:"chronics"`
+	PatientID          string          `json:"patientId,omitempty"`
+	Mode               string          `json:"mode,omitempty"`
+	Symptoms           []DxSymptom     `json:"symptoms"`
+	DeniedSymptoms     []string        `json:"deniedSymptoms,omitempty"`
+	Allergies          []string        `json:"allergies"`
+	Chronics           []string        `json:"chronics"`
+	CurrentMedications []string        `json:"currentMedications,omitempty"`
+	Demographics       *DxDemographics `json:"demographics,omitempty"`
+	Limit              int             `json:"limit,omitempty"`
+	MinAffinity        *float64        `json:"minAffinity,omitempty"`
+	DifferentialOnly   bool            `json:"differentialOnly,omitempty"`
 }
 
+// DxDemographics son los datos del paciente que usan las reglas de dosis y
+// los modificadores de afinidad. Los campos ausentes se tratan como
+// desconocidos.
+type DxDemographics struct {
+	AgeYears            *float64 `json:"ageYears,omitempty"`
+	WeightKg            *float64 `json:"weightKg,omitempty"`
+	CreatinineClearance *float64 `json:"creatinineClearance,omitempty"`
+	Sex                 string   `json:"sex,omitempty"`
+	Pregnant            bool     `json:"pregnant,omitempty"`
+	RiskFactors         []string `json:"riskFactors,omitempty"`
+}
+
+// DxContribution explica el aporte de un síntoma. En modo ponderado trae
+// Severity y Weight; en modo bayes, State (presente o ausente), Likelihood
+// (P(hallazgo|enfermedad)) y LikelihoodRatio (0 si faltan Se y Sp).
 type DxContribution struct {
-	SymptomID    string  `json:"symptomId"`
-	Severity     string  `json:"severity"`
-	Weight       float64 `json:"weight"`
-	Contribution float64 `json:"contribution"`
+	SymptomID       string      `json:"symptomId"`
+	Severity        string      `json:"severity,omitempty"`
+	Weight          float64     `json:"weight,omitempty"`
+	State           string      `json:"state,omitempty"`
+	Likelihood      float64     `json:"likelihood,omitempty"`
+	LikelihoodRatio float64     `json:"likelihoodRatio,omitempty"`
+	Contribution    float64     `json:"contribution"`
+	TimeFit         []DxTimeFit `json:"timeFit,omitempty"`
 }
 
 type DxRule struct {
@@ -36,8 +69,23 @@ type DxRule struct {
 }
 
 type DxMedication struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
+	ID   string  `json:"id"`
+	Name string  `json:"name"`
+	Line int     `json:"line,omitempty"`
+	Dose *DxDose `json:"dose,omitempty"`
+}
+
+// DxAlternative es un tratamiento de la enfermedad en orden de prioridad.
+// Line es la línea de terapia (1 = primera línea); ExcludedBy queda vacío
+// si el medicamento es seguro para el paciente.
+type DxAlternative struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Priority   float64  `json:"priority"`
+	Line       int      `json:"line"`
+	Safe       bool     `json:"safe"`
+	ExcludedBy string   `json:"excludedBy,omitempty"`
+	Warnings   []string `json:"warnings,omitempty"`
 }
 
 type DxResult struct {
@@ -47,22 +95,30 @@ type DxResult struct {
 	AffinityPct    float64          `json:"affinityPercent"`
 	Urgency        string           `json:"urgency"`
 	Medication     *DxMedication    `json:"medication,omitempty"`
+	Alternatives   []DxAlternative  `json:"alternatives,omitempty"`
 	Conflicts      []string         `json:"conflicts,omitempty"`
 	Contributions  []DxContribution `json:"contributions"`
 	RulesActivated []DxRule         `json:"rulesActivated"`
 }
 
+// DiagnosisOut trae los resultados ya filtrados. ID es el del registro en el
+// historial (/api/diagnoses/{id}); solo viene si la corrida se guardó.
+// TotalCandidates cuenta las enfermedades evaluadas y ConfidenceGap la
+// diferencia de afinidad entre los dos primeros; Ambiguous se activa cuando es
+// menor que ambiguityGap. FollowUpQuestions sugiere qué síntomas preguntar para
+// desempatar y Provenance, con patientId, dice qué datos salieron de la ficha.
+// KBVersion es la versión de la base vigente al empezar el cálculo.
 type DiagnosisOut struct {
-	GeneratedAt string      `json:"generatedAt"`
-	Inputs      DiagnosisIn `json:"inputs"`
-	Results     []DxResult  `json:"results"`
-}
-
-func InitDiagnosis() error {
-	if err := Register2(predTrata, fileDiseases); err != nil {
-		return err
-	}
-	return nil
+	ID                string        `json:"id,omitempty"`
+	GeneratedAt       string        `json:"generatedAt"`
+	KBVersion         int           `json:"kbVersion"`
+	Inputs            DiagnosisIn   `json:"inputs"`
+	Results           []DxResult    `json:"results"`
+	TotalCandidates   int           `json:"totalCandidates"`
+	ConfidenceGap     *float64      `json:"confidenceGap,omitempty"`
+	Ambiguous         bool          `json:"ambiguous"`
+	FollowUpQuestions []DxQuestion  `json:"followUpQuestions,omitempty"`
+	Provenance        *DxProvenance `json:"provenance,omitempty"`
 }
 
 func handleDiagnosis(w http.ResponseWriter, r *http.Request) {
@@ -77,161 +133,313 @@ func handleDiagnosis(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(apiError{Error: "JSON inválido"})
 		return
 	}
-	if len(in.Symptoms) == 0 {
+	if msg := applyDiagnosisQuery(&in, r.URL.Query()); msg != "" {
 		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(apiError{Error: "debes enviar al menos un síntoma"})
+		json.NewEncoder(w).Encode(apiError{Error: msg})
 		return
 	}
-
-	severityFactor := map[string]float64{"leve": 0.8, "moderado": 1.0, "severo": 1.2}
-
-	pairsDiseases := List2(predDiseases)
-	triplesES := List3(predDisSym)
-	pairsTrata := List2(predTrata)
-	pairsMeds := List2(predMeds)
-	pairsContra := List2(predContra)
-
-	weight := map[string]map[string]float64{}
-	for _, t := range triplesES {
-		e, s := t[0], t[1]
-		wf, _ := strconv.ParseFloat(t[2], 64)
-		if weight[e] == nil {
-			weight[e] = map[string]float64{}
+	// el diagnóstico anónimo es público; asociarlo a un paciente no
+	if in.PatientID != "" && !hasRole(r, roleClinician) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(apiError{Error: "patientId requiere rol clinico"})
+		return
+	}
+	out, err := diagnosisService.Diagnose(r.Context(), in)
+	if err != nil {
+		var inErr *DiagnosisInputError
+		if errors.As(err, &inErr) {
+			w.WriteHeader(http.StatusBadRequest)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
 		}
-		weight[e][s] = wf
+		json.NewEncoder(w).Encode(apiError{Error: err.Error()})
+		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
 
-	medName := map[string]string{}
-	for _, m := range pairsMeds {
-		medName[m[0]] = m[1]
+// validateDiagnosisIn revisa lo que las reglas no pueden resolver solas;
+// devuelve el mensaje de error o "".
+func validateDiagnosisIn(kb kbView, in DiagnosisIn) string {
+	if diagnosisMode(in.Mode) == "" {
+		return "mode debe ser ponderado o bayes"
 	}
-
-	trata := map[string][]string{}
-	for _, p := range pairsTrata {
-		trata[p[0]] = append(trata[p[0]], p[1])
+	if in.Limit < 0 {
+		return "limit no puede ser negativo"
 	}
-
-	contra := map[[2]string]bool{}
-	for _, c := range pairsContra {
-		contra[[2]string{c[0], c[1]}] = true
+	if in.MinAffinity != nil && (*in.MinAffinity < 0 || *in.MinAffinity > 1) {
+		return "minAffinity debe estar entre 0 y 1"
 	}
-
-	allergies := map[string]bool{}
-	for _, a := range in.Allergies {
-		allergies[toAtom(a)] = true
+	levels := severityLevelSet()
+	present := map[string]bool{}
+	for _, s := range in.Symptoms {
+		present[toAtom(s.ID)] = true
+		if s.Intensity != nil {
+			if *s.Intensity < 0 || *s.Intensity > 10 {
+				return "intensity debe estar entre 0 y 10"
+			}
+			if band := severityForIntensity(kb, *s.Intensity); toAtom(s.Severity) != band {
+				return "la severidad de " + toAtom(s.ID) + " no coincide con su intensidad (" + band + ")"
+			}
+		}
+		if strings.TrimSpace(s.Severity) == "" {
+			return "el síntoma " + toAtom(s.ID) + " necesita severity o intensity"
+		}
+		if !levels[toAtom(s.Severity)] {
+			return "severity debe ser una de: " + strings.Join(sortedKeys(levels), ", ")
+		}
+		if _, ok := normalizeOnset(s.Onset); !ok {
+			return "onset debe ser subito o gradual"
+		}
+		if s.DurationDays != nil && *s.DurationDays < 0 {
+			return "durationDays no puede ser negativo"
+		}
 	}
-	chronics := map[string]bool{}
-	for _, c := range in.Chronics {
-		chronics[toAtom(c)] = true
+	for _, s := range in.DeniedSymptoms {
+		if present[toAtom(s)] {
+			return "el síntoma " + toAtom(s) + " no puede estar presente y negado"
+		}
 	}
+	return ""
+}
 
-	urg, urgRuleDetail := computeUrgency(in.Symptoms)
+// runDiagnosis evalúa las reglas afinidad_modificada/5 (o conjunta_bayes/4
+// con mode bayes), opcion_tratamiento/5 y urgencia_enfermedad/6 de
+// prolog.pl; aquí solo se arman las consultas y se leen las soluciones.
+func runDiagnosis(ctx context.Context, kb kbView, in DiagnosisIn, now time.Time) (DiagnosisOut, error) {
+	mode := diagnosisMode(in.Mode)
+	syms := symptomTerms(in.Symptoms)
+	findings := findingTerms(in.Symptoms, in.DeniedSymptoms)
+	denied := listAtoms(in.DeniedSymptoms)
+	datos := demographicsTerm(in.Demographics)
+	profile := profileTerm(in.Demographics)
+	patient := "paciente(" + listAtoms(in.Allergies) + "," + listAtoms(in.Chronics) + "," + listAtoms(in.CurrentMedications) + "," + datos + ")"
 
-	results := make([]DxResult, 0, len(pairsDiseases))
-	for _, d := range pairsDiseases {
-		eID, eName := d[0], d[1]
-		total := 0.0
+	diseases := kb.ProveAll("enfermedad(E, N).")
+	results := make([]DxResult, 0, len(diseases))
+	scores := make([]float64, 0, len(diseases))
+	for _, d := range diseases {
+		if err := ctx.Err(); err != nil {
+			return DiagnosisOut{}, err
+		}
+		eID, eName := plAtomOf(d.ByName_("E")), plAtomOf(d.ByName_("N"))
+		var total float64
 		var contribs []DxContribution
 		var rules []DxRule
-
-		for _, s := range in.Symptoms {
-			sid := toAtom(s.ID)
-			w := 0.0
-			if weight[eID] != nil {
-				w = weight[eID][sid]
-			}
-			f := severityFactor[strings.ToLower(s.Severity)]
-			if f == 0 {
-				f = 1.0
-			}
-			c := w * f
-			if c > 0 {
-				contribs = append(contribs, DxContribution{
-					SymptomID: sid, Severity: strings.ToLower(s.Severity), Weight: round2dx(w), Contribution: round2dx(c),
-				})
-				rules = append(rules, DxRule{Rule: "enfermedad_sintoma/3", Details: eID + "," + sid + "," + strconv.FormatFloat(w, 'g', -1, 64)})
-			}
-			total += c
-		}
-		if total > 1.0 {
-			total = 1.0
+		if mode == modeBayes {
+			total, contribs, rules = scoreBayes(kb, eID, findings, profile)
+		} else {
+			total, contribs, rules = scoreWeighted(kb, eID, syms, denied, profile)
 		}
 
-		mChosen := (*DxMedication)(nil)
+		alts := treatmentOptions(kb, eID, patient)
+		var mChosen *DxMedication
 		var conflicts []string
-		for _, m := range trata[eID] {
-			if allergies[m] {
-				conflicts = append(conflicts, "alergia:"+m)
-				continue
-			}
-			conflict := false
-			for ch := range chronics {
-				if contra[[2]string{m, ch}] {
-					conflicts = append(conflicts, "contra:"+m+"-"+ch)
-					conflict = true
-					break
+		for _, a := range alts {
+			if !a.Safe {
+				conflicts = append(conflicts, a.ExcludedBy)
+				if strings.HasPrefix(a.ExcludedBy, "interaccion:") {
+					rules = append(rules, DxRule{Rule: "interaccion/3", Details: a.ExcludedBy + "->excluido"})
 				}
-			}
-			if conflict {
 				continue
 			}
-			name := medName[m]
-			if name == "" {
-				name = m
+			if mChosen == nil {
+				mChosen = &DxMedication{ID: a.ID, Name: a.Name, Line: a.Line, Dose: computeDose(kb, a.ID, datos)}
+				rules = append(rules, DxRule{Rule: "opcion_tratamiento/5", Details: eID + "," + a.ID + ",linea " + strconv.Itoa(a.Line)})
+				if d := mChosen.Dose; d != nil {
+					rules = append(rules, DxRule{Rule: "dosis_recomendada/7", Details: a.ID + "," + d.AgeGroup + "->" + d.Text})
+				}
+				for _, wn := range a.Warnings {
+					conflicts = append(conflicts, wn)
+					rules = append(rules, DxRule{Rule: "interaccion/3", Details: wn + "->advertencia"})
+				}
 			}
-			mChosen = &DxMedication{ID: m, Name: name}
-			rules = append(rules, DxRule{Rule: "trata/2", Details: eID + "," + m})
-			break
 		}
-		if mChosen == nil && len(trata[eID]) > 0 && len(conflicts) > 0 {
+		if mChosen == nil && len(conflicts) > 0 {
 			rules = append(rules, DxRule{Rule: "exclusion_tratamiento", Details: strings.Join(conflicts, ";")})
 		}
-		rules = append(rules, DxRule{Rule: "urgencia/2", Details: urgRuleDetail})
+		urg, urgRule := diseaseUrgency(kb, eID, syms, profile)
+		rules = append(rules, urgRule)
 
+		scores = append(scores, total)
 		results = append(results, DxResult{
 			DiseaseID:      eID,
 			DiseaseName:    eName,
-			Affinity:       round2dx(total),
-			AffinityPct:    round2dx(total * 100),
 			Urgency:        urg,
 			Medication:     mChosen,
+			Alternatives:   alts,
 			Conflicts:      conflicts,
 			Contributions:  contribs,
 			RulesActivated: rules,
 		})
 	}
 
-	sort.Slice(results, func(i, j int) bool { return results[i].Affinity > results[j].Affinity })
+	// en modo bayes la posterior es la conjunta dividida por la suma de
+	// todas las enfermedades
+	sum := 0.0
+	for _, v := range scores {
+		sum += v
+	}
+	for i, v := range scores {
+		if mode == modeBayes && sum > 0 {
+			v /= sum
+		}
+		results[i].Affinity = round2dx(v)
+		results[i].AffinityPct = round2dx(v * 100)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Affinity > results[j].Affinity })
+	gap, ambiguous := confidenceGap(results)
 
-	out := DiagnosisOut{
-		GeneratedAt: time.Now().UTC().Format(time.RFC3339),
-		Inputs:      in,
-		Results:     results,
+	matched := map[string]bool{}
+	if in.DifferentialOnly {
+		for _, s := range kb.ProveAll("enfermedad(E,_), comparte_sintoma(E," + syms + ").") {
+			matched[plAtomOf(s.ByName_("E"))] = true
+		}
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(out)
+
+	return DiagnosisOut{
+		GeneratedAt:       now.Format(time.RFC3339),
+		KBVersion:         kb.Version,
+		Inputs:            in,
+		Results:           filterResults(in, results, matched),
+		TotalCandidates:   len(results),
+		ConfidenceGap:     gap,
+		Ambiguous:         ambiguous,
+		FollowUpQuestions: followUpQuestions(kb, in, results),
+	}, nil
 }
 
-func computeUrgency(syms []DxSymptom) (string, string) {
-	hasSevere := false
-	hasModerate := false
-	var sevs []string
-	for _, s := range syms {
-		ss := strings.ToLower(strings.TrimSpace(s.Severity))
-		sevs = append(sevs, toAtom(ss))
-		if ss == "severo" {
-			hasSevere = true
-		} else if ss == "moderado" {
-			hasModerate = true
+// scoreWeighted es la suma de pesos de enfermedad_sintoma/3 por el factor de
+// severidad, menos las penalizaciones de los síntomas negados, escalada por
+// los modificadores y con tope 1.
+func scoreWeighted(kb kbView, eID, syms, denied, profile string) (float64, []DxContribution, []DxRule) {
+	var contribs []DxContribution
+	var rules []DxRule
+	fits := timeFits(kb, eID, syms)
+	for _, s := range kb.ProveAll("contribucion(" + plAtom(eID) + "," + syms + ",S,Sev,W,C).") {
+		sid, wf, c := plAtomOf(s.ByName_("S")), plNumberOf(s.ByName_("W")), plNumberOf(s.ByName_("C"))
+		if c <= 0 {
+			continue
+		}
+		contribs = append(contribs, DxContribution{
+			SymptomID: sid, Severity: plAtomOf(s.ByName_("Sev")), Weight: round2dx(wf), Contribution: round2dx(c), TimeFit: fits[sid],
+		})
+		rules = append(rules, DxRule{Rule: "enfermedad_sintoma/3", Details: eID + "," + sid + "," + strconv.FormatFloat(wf, 'g', -1, 64)})
+		for _, f := range fits[sid] {
+			rule := "duracion_tipica/4"
+			if f.Aspect == "inicio" {
+				rule = "inicio_tipico/3"
+			}
+			rules = append(rules, DxRule{Rule: rule, Details: eID + "," + sid + "," + f.Fit + " (" + f.Expected + "),x" + strconv.FormatFloat(f.Factor, 'g', -1, 64)})
+		}
+	}
+	pc, pr := penaltyContributions(kb, eID, denied)
+	contribs, rules = append(contribs, pc...), append(rules, pr...)
+	total := 0.0
+	if sols := kb.ProveAll("afinidad_modificada(" + plAtom(eID) + "," + syms + "," + denied + "," + profile + ",T)."); len(sols) > 0 {
+		total = plNumberOf(sols[0].ByName_("T"))
+	}
+	if total > 0 {
+		for _, s := range kb.ProveAll("modificador_aplicado(" + plAtom(eID) + "," + profile + ",Cond,F).") {
+			rules = append(rules, DxRule{Rule: "modificador/3", Details: eID + "," + plAtomOf(s.ByName_("Cond")) + ",x" + strconv.FormatFloat(plNumberOf(s.ByName_("F")), 'g', -1, 64)})
 		}
 	}
-	if hasSevere {
-		return "consulta_medica_inmediata_sugerida", strings.Join(sevs, ",") + "->consulta_medica_inmediata_sugerida"
+	return total, contribs, rules
+}
+
+// treatmentOptions lista los tratamientos de la enfermedad según
+// opcion_tratamiento/5. La línea de terapia sube cada vez que cambia la
+// prioridad, así dos medicamentos con la misma prioridad comparten línea.
+func treatmentOptions(kb kbView, eID, patient string) []DxAlternative {
+	var out []DxAlternative
+	line, last := 0, math.Inf(-1)
+	for _, s := range kb.ProveAll("opcion_tratamiento(" + plAtom(eID) + "," + patient + ",M,P,R).") {
+		m, p := plAtomOf(s.ByName_("M")), plNumberOf(s.ByName_("P"))
+		if p != last {
+			line, last = line+1, p
+		}
+		a := DxAlternative{ID: m, Name: medicationName(kb, m), Priority: p, Line: line, Safe: true}
+		if r := s.ByName_("R"); plAtomOf(r) != "seguro" {
+			a.Safe = false
+			a.ExcludedBy = conflictLabel(r)
+		}
+		out = append(out, a)
 	}
-	if hasModerate {
-		return "observacion_recomendada", strings.Join(sevs, ",") + "->observacion_recomendada"
+	warnings := map[string][]string{}
+	for _, s := range kb.ProveAll("tratamientos_ordenados(" + plAtom(eID) + ",Ms), member(M,Ms), advertencia(M," + patient + ",R).") {
+		m := plAtomOf(s.ByName_("M"))
+		warnings[m] = append(warnings[m], conflictLabel(s.ByName_("R")))
+	}
+	for i := range out {
+		out[i].Warnings = warnings[out[i].ID]
+	}
+	return out
+}
+
+// profileTerm arma perfil(Edad, Sexo, Embarazo, Factores) para
+// condicion_paciente/2.
+func profileTerm(d *DxDemographics) string {
+	if d == nil {
+		return "perfil(desconocido,desconocido,no,[])"
+	}
+	age := "desconocido"
+	if d.AgeYears != nil && *d.AgeYears >= 0 {
+		age = strconv.FormatFloat(*d.AgeYears, 'f', -1, 64)
+	}
+	sex := "desconocido"
+	switch toAtom(d.Sex) {
+	case "f", "femenino", "mujer":
+		sex = "femenino"
+	case "m", "masculino", "hombre":
+		sex = "masculino"
+	}
+	pregnant := "no"
+	if d.Pregnant {
+		pregnant = "si"
+	}
+	return "perfil(" + age + "," + sex + "," + pregnant + "," + listAtoms(d.RiskFactors) + ")"
+}
+
+// symptomTerms arma la lista [s(Id,Severidad,Inicio,Dias),...] que reciben
+// las reglas; inicio y días ausentes van como desconocido.
+func symptomTerms(syms []DxSymptom) string {
+	items := make([]string, len(syms))
+	for i, s := range syms {
+		onset, _ := normalizeOnset(s.Onset)
+		items[i] = "s(" + plAtom(toAtom(s.ID)) + "," + plAtom(toAtom(s.Severity)) + "," + onset + "," + durationTerm(s.DurationDays) + ")"
+	}
+	return "[" + strings.Join(items, ",") + "]"
+}
+
+func conflictLabel(t term.Term) string {
+	c, ok := t.(term.Callable)
+	if !ok {
+		return fmt.Sprint(t)
+	}
+	args := make([]string, len(c.Arguments()))
+	for i, a := range c.Arguments() {
+		args[i] = plAtomOf(a)
+	}
+	switch {
+	case c.Name() == "alergia" && len(args) == 1:
+		return "alergia:" + args[0]
+	case c.Name() == "contra" && len(args) == 2:
+		return "contra:" + args[0] + "-" + args[1]
+	case c.Name() == "renal" && len(args) == 2:
+		return "renal:" + args[0] + "(clcr " + args[1] + ")"
+	case c.Name() == "interaccion" && len(args) == 3:
+		return "interaccion:" + args[0] + "-" + args[1] + "(" + args[2] + ")"
+	}
+	return c.Name() + ":" + strings.Join(args, "-")
+}
+
+func medicationName(kb kbView, id string) string {
+	if sols := kb.ProveAll("medicamento(" + plAtom(id) + ",N)."); len(sols) > 0 {
+		return plAtomOf(sols[0].ByName_("N"))
 	}
-	return "posible_automanejo", strings.Join(sevs, ",") + "->posible_automanejo"
+	return id
 }
 
 func listAtoms(vals []string) string {
@@ -240,7 +448,7 @@ func listAtoms(vals []string) string {
 	}
 	items := make([]string, len(vals))
 	for i, v := range vals {
-		items[i] = toAtom(v)
+		items[i] = plAtom(toAtom(v))
 	}
 	return "[" + strings.Join(items, ",") + "]"
 }
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/url"
+	"strconv"
+)
+
+// ambiguityGap es la diferencia de afinidad entre los dos primeros
+// candidatos por debajo de la cual el resultado se marca como ambiguo.
+const ambiguityGap = 0.1
+
+// applyDiagnosisQuery toma limit, minAffinity y differential de la query
+// string; si vienen, pisan a los del cuerpo. Devuelve el mensaje de error o "".
+func applyDiagnosisQuery(in *DiagnosisIn, q url.Values) string {
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return "limit debe ser un entero"
+		}
+		in.Limit = n
+	}
+	if v := q.Get("minAffinity"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return "minAffinity debe ser un número"
+		}
+		in.MinAffinity = &f
+	}
+	if v := q.Get("differential"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return "differential debe ser true o false"
+		}
+		in.DifferentialOnly = b
+	}
+	return ""
+}
+
+// confidenceGap es la diferencia entre los dos primeros resultados ya
+// ordenados (o la afinidad del único). Se calcula antes de filtrar para que
+// no dependa de limit ni de minAffinity.
+func confidenceGap(results []DxResult) (*float64, bool) {
+	if len(results) == 0 {
+		return nil, false
+	}
+	gap := results[0].Affinity
+	if len(results) > 1 {
+		gap -= results[1].Affinity
+	}
+	gap = round2dx(gap)
+	return &gap, len(results) > 1 && gap < ambiguityGap
+}
+
+// filterResults aplica differentialOnly, minAffinity y limit, en ese orden,
+// sobre los resultados ya ordenados. matched dice qué enfermedades comparten
+// algún síntoma presente.
+func filterResults(in DiagnosisIn, results []DxResult, matched map[string]bool) []DxResult {
+	out := make([]DxResult, 0, len(results))
+	for _, r := range results {
+		if in.DifferentialOnly && !matched[r.DiseaseID] {
+			continue
+		}
+		if in.MinAffinity != nil && r.Affinity < *in.MinAffinity {
+			continue
+		}
+		out = append(out, r)
+	}
+	if in.Limit > 0 && len(out) > in.Limit {
+		out = out[:in.Limit]
+	}
+	return out
+}
@@ -3,9 +3,9 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"math"
 	"net/http"
-	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -19,12 +19,41 @@ func handleDiagnosisPDF(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	var in DiagnosisIn
-	if err := json.NewDecoder(r.Body).Decode(&in); err != nil || len(in.Symptoms) == 0 {
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
 		http.Error(w, "JSON inválido", http.StatusBadRequest)
 		return
 	}
-	out := runDiagnosisReport(in)
+	if msg := applyDiagnosisQuery(&in, r.URL.Query()); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	if in.PatientID != "" && !hasRole(r, roleClinician) {
+		http.Error(w, "patientId requiere rol clinico", http.StatusForbidden)
+		return
+	}
+	out, err := diagnosisService.Diagnose(r.Context(), in)
+	if err != nil {
+		var inErr *DiagnosisInputError
+		if errors.As(err, &inErr) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	b, err := renderDiagnosisPDF(out)
+	if err != nil {
+		http.Error(w, "error generando PDF", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", "attachment; filename=diagnostico.pdf")
+	w.Write(b)
+}
 
+// renderDiagnosisPDF arma el informe a partir de un DiagnosisOut ya
+// calculado, así el PDF muestra exactamente lo mismo que el JSON.
+func renderDiagnosisPDF(out DiagnosisOut) ([]byte, error) {
 	pdf := gofpdf.New("P", "mm", "A4", "")
 	pdf.SetMargins(15, 15, 15)
 	pdf.AddPage()
@@ -34,7 +63,20 @@ func handleDiagnosisPDF(w http.ResponseWriter, r *http.Request) {
 	pdf.Ln(8)
 
 	pdf.SetFont("Arial", "", 11)
-	pdf.Cell(0, 6, "Fecha: "+time.Now().Format("2006-01-02 15:04"))
+	fecha := out.GeneratedAt
+	if t, err := time.Parse(time.RFC3339, out.GeneratedAt); err == nil {
+		fecha = t.Format("2006-01-02 15:04")
+	}
+	if out.KBVersion > 0 {
+		fecha += "   Base v" + strconv.Itoa(out.KBVersion)
+	}
+	if out.ID != "" {
+		fecha += "   Registro: " + out.ID
+	}
+	if out.Inputs.PatientID != "" {
+		fecha += "   Paciente: " + out.Inputs.PatientID
+	}
+	pdf.Cell(0, 6, "Fecha: "+fecha)
 	pdf.Ln(6)
 
 	pdf.SetFont("Arial", "B", 12)
@@ -47,6 +89,15 @@ func handleDiagnosisPDF(w http.ResponseWriter, r *http.Request) {
 	pdf.SetFont("Arial", "B", 12)
 	pdf.Cell(0, 7, "Resultados")
 	pdf.Ln(8)
+	if out.ConfidenceGap != nil {
+		pdf.SetFont("Arial", "", 10)
+		line := "Mostrando " + strconv.Itoa(len(out.Results)) + " de " + strconv.Itoa(out.TotalCandidates) + " enfermedades. Diferencia entre los dos primeros: " + trimFloat(*out.ConfidenceGap)
+		if out.Ambiguous {
+			line += " (resultado ambiguo)"
+		}
+		pdf.MultiCell(0, 5, line, "", "L", false)
+		pdf.Ln(2)
+	}
 
 	header := []string{"Enfermedad", "Afinidad", "Urgencia", "Medicamento"}
 	colW := []float64{60, 60, 40, 25}
@@ -82,6 +133,28 @@ func handleDiagnosisPDF(w http.ResponseWriter, r *http.Request) {
 		}
 
 		pdf.SetFont("Arial", "", 9)
+		if rls.Medication != nil && rls.Medication.Dose != nil {
+			d := rls.Medication.Dose
+			line := "Dosis (" + d.AgeGroup + "): " + trimFloat(d.DoseMg) + " mg cada " + trimFloat(d.IntervalHours) + " h, max " + trimFloat(d.DailyMg) + " mg/dia"
+			if d.RenalFactor != 1 {
+				line += ", ajuste renal x" + trimFloat(d.RenalFactor)
+			}
+			pdf.MultiCell(0, 5, line, "LRB", "L", false)
+		}
+		if len(rls.Alternatives) > 1 {
+			var ab strings.Builder
+			ab.WriteString("Alternativas: ")
+			for i, a := range rls.Alternatives {
+				if i > 0 {
+					ab.WriteString(" | ")
+				}
+				ab.WriteString(strconv.Itoa(a.Line) + "a linea " + a.Name)
+				if !a.Safe {
+					ab.WriteString(" (excluido: " + a.ExcludedBy + ")")
+				}
+			}
+			pdf.MultiCell(0, 5, ab.String(), "LRB", "L", false)
+		}
 		if len(rls.Contributions) > 0 {
 			var sb strings.Builder
 			sb.WriteString("Contribuciones: ")
@@ -89,7 +162,14 @@ func handleDiagnosisPDF(w http.ResponseWriter, r *http.Request) {
 				if i > 0 {
 					sb.WriteString(" | ")
 				}
-				sb.WriteString(c.SymptomID + "(" + c.Severity + "): " + trimFloat(c.Contribution))
+				label := c.Severity
+				if c.State != "" {
+					label = c.State
+				}
+				sb.WriteString(c.SymptomID + "(" + label + "): " + trimFloat(c.Contribution))
+				for _, f := range c.TimeFit {
+					sb.WriteString(" [" + f.Aspect + " " + f.Fit + ", esperado " + f.Expected + ", x" + trimFloat(f.Factor) + "]")
+				}
 			}
 			pdf.MultiCell(0, 5, sb.String(), "LRB", "L", false)
 		}
@@ -108,6 +188,16 @@ func handleDiagnosisPDF(w http.ResponseWriter, r *http.Request) {
 		pdf.Ln(2)
 	}
 
+	if len(out.FollowUpQuestions) > 0 {
+		var qs []string
+		for _, q := range out.FollowUpQuestions {
+			qs = append(qs, q.SymptomID+" ("+strings.Join(q.Favors, ", ")+")")
+		}
+		pdf.SetFont("Arial", "", 10)
+		pdf.MultiCell(0, 5, "Preguntas sugeridas: "+strings.Join(qs, " | "), "", "L", false)
+		pdf.Ln(2)
+	}
+
 	pdf.SetFont("Arial", "B", 12)
 	pdf.Cell(0, 7, "Notas")
 	pdf.Ln(7)
@@ -116,138 +206,9 @@ func handleDiagnosisPDF(w http.ResponseWriter, r *http.Request) {
 
 	var buf bytes.Buffer
 	if err := pdf.Output(&buf); err != nil {
-		http.Error(w, "error generando PDF", http.StatusInternalServerError)
-		return
-	}
-	w.Header().Set("Content-Type", "application/pdf")
-	w.Header().Set("Content-Disposition", "attachment; filename=diagnostico.pdf")
-	w.Write(buf.Bytes())
-}
-
-func runDiagnosisReport(in DiagnosisIn) DiagnosisOut {
-	severityFactor := map[string]float64{"leve": 0.8, "moderado": 1.0, "severo": 1.2}
-
-	pairsDiseases := List2(predDiseases)
-	triplesES := List3(predDisSym)
-	pairsTrata := List2("trata")
-	pairsMeds := List2(predMeds)
-	pairsContra := List2(predContra)
-
-	weight := map[string]map[string]float64{}
-	for _, t := range triplesES {
-		e, s := t[0], t[1]
-		wf, _ := strconv.ParseFloat(t[2], 64)
-		if weight[e] == nil {
-			weight[e] = map[string]float64{}
-		}
-		weight[e][s] = wf
-	}
-
-	medName := map[string]string{}
-	for _, m := range pairsMeds {
-		medName[m[0]] = m[1]
-	}
-
-	trata := map[string][]string{}
-	for _, p := range pairsTrata {
-		trata[p[0]] = append(trata[p[0]], p[1])
-	}
-
-	contra := map[[2]string]bool{}
-	for _, c := range pairsContra {
-		contra[[2]string{c[0], c[1]}] = true
-	}
-
-	allergies := map[string]bool{}
-	for _, a := range in.Allergies {
-		allergies[toAtom(a)] = true
-	}
-	chronics := map[string]bool{}
-	for _, c := range in.Chronics {
-		chronics[toAtom(c)] = true
-	}
-
-	urg, urgDetail := computeUrgencyPDF(in.Symptoms)
-
-	results := make([]DxResult, 0, len(pairsDiseases))
-	for _, d := range pairsDiseases {
-		eID, eName := d[0], d[1]
-		total := 0.0
-		var contribs []DxContribution
-		var rules []DxRule
-
-		for _, s := range in.Symptoms {
-			sid := toAtom(s.ID)
-			w := 0.0
-			if weight[eID] != nil {
-				w = weight[eID][sid]
-			}
-			f := severityFactor[strings.ToLower(s.Severity)]
-			if f == 0 {
-				f = 1.0
-			}
-			c := w * f
-			if c > 0 {
-				contribs = append(contribs, DxContribution{
-					SymptomID: sid, Severity: strings.ToLower(s.Severity), Weight: round2dx(w), Contribution: round2dx(c),
-				})
-				rules = append(rules, DxRule{Rule: "enfermedad_sintoma/3", Details: eID + "," + sid + "," + strconv.FormatFloat(w, 'g', -1, 64)})
-			}
-			total += c
-		}
-		if total > 1.0 {
-			total = 1.0
-		}
-
-		var mChosen *DxMedication
-		var conflicts []string
-		for _, m := range trata[eID] {
-			if allergies[m] {
-				conflicts = append(conflicts, "alergia:"+m)
-				continue
-			}
-			conflict := false
-			for ch := range chronics {
-				if contra[[2]string{m, ch}] {
-					conflicts = append(conflicts, "contra:"+m+"-"+ch)
-					conflict = true
-					break
-				}
-			}
-			if conflict {
-				continue
-			}
-			name := medName[m]
-			if name == "" {
-				name = m
-			}
-			mChosen = &DxMedication{ID: m, Name: name}
-			rules = append(rules, DxRule{Rule: "trata/2", Details: eID + "," + m})
-			break
-		}
-		if mChosen == nil && len(trata[eID]) > 0 && len(conflicts) > 0 {
-			rules = append(rules, DxRule{Rule: "exclusion_tratamiento", Details: strings.Join(conflicts, ";")})
-		}
-		rules = append(rules, DxRule{Rule: "urgencia/2", Details: urgDetail})
-
-		results = append(results, DxResult{
-			DiseaseID:      eID,
-			DiseaseName:    eName,
-			Affinity:       round2dx(total),
-			AffinityPct:    round2dx(total * 100),
-			Urgency:        urg,
-			Medication:     mChosen,
-			Conflicts:      conflicts,
-			Contributions:  contribs,
-			RulesActivated: rules,
-		})
-	}
-	sort.Slice(results, func(i, j int) bool { return results[i].Affinity > results[j].Affinity })
-	return DiagnosisOut{
-		GeneratedAt: time.Now().UTC().Format(time.RFC3339),
-		Inputs:      in,
-		Results:     results,
+		return nil, err
 	}
+	return buf.Bytes(), nil
 }
 
 func drawAffinityBar(pdf *gofpdf.Fpdf, x, y, w float64, h float64, affinity float64) {
@@ -256,28 +217,6 @@ func drawAffinityBar(pdf *gofpdf.Fpdf, x, y, w float64, h float64, affinity floa
 	pdf.Rect(x, y, bw, h, "F")
 }
 
-func computeUrgencyPDF(syms []DxSymptom) (string, string) {
-	hasSevere := false
-	hasModerate := false
-	var sevs []string
-	for _, s := range syms {
-		ss := strings.ToLower(strings.TrimSpace(s.Severity))
-		sevs = append(sevs, toAtom(ss))
-		if ss == "severo" {
-			hasSevere = true
-		} else if ss == "moderado" {
-			hasModerate = true
-		}
-	}
-	if hasSevere {
-		return "consulta_medica_inmediata_sugerida", strings.Join(sevs, ",") + "->consulta_medica_inmediata_sugerida"
-	}
-	if hasModerate {
-		return "observacion_recomendada", strings.Join(sevs, ",") + "->observacion_recomendada"
-	}
-	return "posible_automanejo", strings.Join(sevs, ",") + "->posible_automanejo"
-}
-
 func trimFloat(v float64) string {
 	s := strconv.FormatFloat(v, 'f', 2, 64)
 	s = strings.TrimRight(s, "0")
@@ -285,10 +224,38 @@ func trimFloat(v float64) string {
 	return s
 }
 
+// symptomQualifiers resume severidad, intensidad, inicio y duración del
+// síntoma.
+func symptomQualifiers(x DxSymptom) string {
+	q := []string{strings.ToLower(x.Severity)}
+	if x.Intensity != nil {
+		q = append(q, "intensidad "+trimFloat(*x.Intensity)+"/10")
+	}
+	if onset, _ := normalizeOnset(x.Onset); onset != "desconocido" {
+		q = append(q, onset)
+	}
+	if x.DurationDays != nil {
+		q = append(q, trimFloat(*x.DurationDays)+" dias")
+	}
+	return strings.Join(q, ", ")
+}
+
 func formatInputs(in DiagnosisIn) string {
 	var a, c, s []string
 	for _, x := range in.Allergies { a = append(a, toAtom(x)) }
 	for _, x := range in.Chronics  { c = append(c, toAtom(x)) }
-	for _, x := range in.Symptoms  { s = append(s, toAtom(x.ID)+"("+strings.ToLower(x.Severity)+")") }
-	return "Sintomas: [" + strings.Join(s, ", ") + "]\nAlergias: [" + strings.Join(a, ", ") + "]\nCronicas: [" + strings.Join(c, ", ") + "]"
+	for _, x := range in.Symptoms  { s = append(s, toAtom(x.ID)+"("+symptomQualifiers(x)+")") }
+	var m []string
+	for _, x := range in.CurrentMedications { m = append(m, toAtom(x)) }
+	dem := ""
+	if d := in.Demographics; d != nil {
+		if d.AgeYears != nil { dem += "\nEdad: " + trimFloat(*d.AgeYears) }
+		if d.WeightKg != nil { dem += "\nPeso: " + trimFloat(*d.WeightKg) + " kg" }
+		if d.CreatinineClearance != nil { dem += "\nAclaramiento de creatinina: " + trimFloat(*d.CreatinineClearance) + " mL/min" }
+		if d.Sex != "" { dem += "\nSexo: " + toAtom(d.Sex) }
+		if d.Pregnant { dem += "\nEmbarazo: si" }
+		if len(d.RiskFactors) > 0 { dem += "\nFactores de riesgo: " + strings.Trim(listAtoms(d.RiskFactors), "[]") }
+	}
+	if len(in.DeniedSymptoms) > 0 { dem = "\nSintomas negados: [" + strings.Trim(listAtoms(in.DeniedSymptoms), "[]") + "]" + dem }
+	return "Sintomas: [" + strings.Join(s, ", ") + "]\nAlergias: [" + strings.Join(a, ", ") + "]\nCronicas: [" + strings.Join(c, ", ") + "]\nMedicacion actual: [" + strings.Join(m, ", ") + "]" + dem
 }
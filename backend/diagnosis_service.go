@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// DiagnosisService es la única entrada al diagnóstico: la usan el endpoint
+// JSON y el PDF, y cualquier otro canal (CLI, lotes) debería pasar por aquí
+// para que todos devuelvan exactamente los mismos resultados.
+type DiagnosisService struct {
+	// Now da la hora de GeneratedAt; nil usa time.Now.
+	Now func() time.Time
+	// Records guarda en el historial las corridas con patientId pedidas por
+	// un clínico con sesión; nil no guarda nada.
+	Records *recordStore
+}
+
+var diagnosisService = &DiagnosisService{}
+
+// DiagnosisInputError indica una entrada inválida (400 en HTTP).
+type DiagnosisInputError struct {
+	Msg string
+}
+
+func (e *DiagnosisInputError) Error() string { return e.Msg }
+
+// Diagnose valida la entrada, completa con la ficha del paciente si viene
+// patientId, evalúa las reglas y, con patientId y un clínico en ctx, guarda
+// la corrida en el historial. Las corridas anónimas no se guardan. Devuelve
+// *DiagnosisInputError si la entrada no es válida y ctx.Err() si se cancela
+// a mitad de la evaluación.
+func (s *DiagnosisService) Diagnose(ctx context.Context, in DiagnosisIn) (DiagnosisOut, error) {
+	if len(in.Symptoms) == 0 {
+		return DiagnosisOut{}, &DiagnosisInputError{Msg: "debes enviar al menos un síntoma"}
+	}
+	// toda la corrida usa la misma máquina y la versión que la generó
+	kb := kbCurrent()
+	in.Symptoms = resolveIntensities(kb, in.Symptoms)
+	if msg := validateDiagnosisIn(kb, in); msg != "" {
+		return DiagnosisOut{}, &DiagnosisInputError{Msg: msg}
+	}
+	var prov *DxProvenance
+	if in.PatientID != "" {
+		in.PatientID = toAtom(in.PatientID)
+		if s.Records == nil {
+			return DiagnosisOut{}, &DiagnosisInputError{Msg: "no hay registro de pacientes"}
+		}
+		p, err := s.Records.Patient(in.PatientID)
+		if err != nil {
+			if errors.Is(err, errRecordNotFound) {
+				return DiagnosisOut{}, &DiagnosisInputError{Msg: "no existe el paciente " + in.PatientID}
+			}
+			return DiagnosisOut{}, err
+		}
+		in, prov = mergePatientProfile(in, p)
+	}
+	now := time.Now
+	if s.Now != nil {
+		now = s.Now
+	}
+	out, err := runDiagnosis(ctx, kb, in, now().UTC())
+	if err != nil {
+		return DiagnosisOut{}, err
+	}
+	out.Provenance = prov
+	if s.Records == nil || in.PatientID == "" || !ctxHasRole(ctx, roleClinician) {
+		return out, nil
+	}
+	rec := DiagnosisRecord{ID: newRecordID("dx"), PatientID: in.PatientID, GeneratedAt: out.GeneratedAt}
+	out.ID = rec.ID
+	rec.Output = out
+	if err := s.Records.SaveDiagnosis(rec); err != nil {
+		return DiagnosisOut{}, err
+	}
+	return out, nil
+}
+
+// resolveIntensities completa la severidad de los síntomas que solo traen
+// intensidad 0–10 con el nivel de su banda. Devuelve una copia.
+func resolveIntensities(kb kbView, syms []DxSymptom) []DxSymptom {
+	out := make([]DxSymptom, len(syms))
+	copy(out, syms)
+	for i, s := range out {
+		if s.Intensity != nil && s.Severity == "" && *s.Intensity >= 0 && *s.Intensity <= 10 {
+			out[i].Severity = severityForIntensity(kb, *s.Intensity)
+		}
+	}
+	return out
+}
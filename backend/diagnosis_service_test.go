@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "reescribe los golden de testdata/diagnosis")
+
+// TestDiagnoseGolden corre cada testdata/diagnosis/*.input.json, compara la
+// salida JSON con su .golden.json y comprueba que el PDF muestre los mismos
+// datos. Con -update se reescriben los golden.
+func TestDiagnoseGolden(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "diagnosis", "*.input.json"))
+	if err != nil || len(inputs) == 0 {
+		t.Fatal("no hay entradas en testdata/diagnosis")
+	}
+	svc := &DiagnosisService{Now: func() time.Time { return time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC) }}
+	for _, file := range inputs {
+		name := strings.TrimSuffix(filepath.Base(file), ".input.json")
+		t.Run(name, func(t *testing.T) {
+			src, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var in DiagnosisIn
+			if err := json.Unmarshal(src, &in); err != nil {
+				t.Fatal(err)
+			}
+			out, err := svc.Diagnose(context.Background(), in)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := json.MarshalIndent(out, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, '\n')
+			golden := strings.TrimSuffix(file, ".input.json") + ".golden.json"
+			if *update {
+				if err := os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("la salida no coincide con %s (go test -run Golden -update la regenera):\n%s", golden, got)
+			}
+
+			pdf, err := renderDiagnosisPDF(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			text := pdfText(pdf)
+			for _, s := range pdfExpectations(out) {
+				if !strings.Contains(text, s) {
+					t.Errorf("el PDF no muestra %q", s)
+				}
+			}
+		})
+	}
+}
+
+// pdfExpectations lista los datos de la salida JSON que el PDF tiene que
+// mostrar, con el mismo formato que usa renderDiagnosisPDF.
+func pdfExpectations(out DiagnosisOut) []string {
+	want := []string{"Base v" + strconv.Itoa(out.KBVersion)}
+	if out.ConfidenceGap != nil {
+		want = append(want, "Mostrando "+strconv.Itoa(len(out.Results))+" de "+strconv.Itoa(out.TotalCandidates)+" enfermedades", trimFloat(*out.ConfidenceGap))
+	}
+	for _, r := range out.Results {
+		want = append(want, r.DiseaseName, strconv.Itoa(int(math.Round(r.Affinity*100)))+"%", r.Urgency)
+		if m := r.Medication; m != nil {
+			want = append(want, m.Name)
+			if d := m.Dose; d != nil {
+				want = append(want, "Dosis ("+d.AgeGroup+"): "+trimFloat(d.DoseMg)+" mg cada "+trimFloat(d.IntervalHours)+" h")
+			}
+		}
+		want = append(want, r.Conflicts...)
+		for _, c := range r.Contributions {
+			label := c.Severity
+			if c.State != "" {
+				label = c.State
+			}
+			want = append(want, c.SymptomID+"("+label+"): "+trimFloat(c.Contribution))
+		}
+	}
+	for _, q := range out.FollowUpQuestions {
+		want = append(want, q.SymptomID)
+	}
+	return want
+}
+
+var (
+	pdfStream   = regexp.MustCompile(`(?s)stream\r?\n(.*?)\r?\nendstream`)
+	pdfShowText = regexp.MustCompile(`\(((?:\\.|[^\\)])*)\)\s*Tj`)
+	pdfUnescape = strings.NewReplacer(`\\`, `\`, `\(`, `(`, `\)`, `)`)
+)
+
+// pdfText junta el texto de los operadores Tj de los streams del PDF, que
+// gofpdf comprime con zlib. MultiCell parte las líneas en los espacios, así
+// que el resultado se une con un espacio y se colapsan los blancos.
+func pdfText(pdf []byte) string {
+	var parts []string
+	for _, m := range pdfStream.FindAllSubmatch(pdf, -1) {
+		zr, err := zlib.NewReader(bytes.NewReader(m[1]))
+		if err != nil {
+			continue
+		}
+		content, err := io.ReadAll(zr)
+		if err != nil {
+			continue
+		}
+		for _, s := range pdfShowText.FindAllSubmatch(content, -1) {
+			parts = append(parts, pdfUnescape.Replace(string(s[1])))
+		}
+	}
+	return strings.Join(strings.Fields(strings.Join(parts, " ")), " ")
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
@@ -83,18 +84,35 @@ func CreateDisease(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(apiError{Error: "id y name son obligatorios"})
 		return
 	}
-	if _, ok := Create2(predDiseases, in.ID, in.Name); !ok {
-		w.WriteHeader(http.StatusConflict)
-		json.NewEncoder(w).Encode(apiError{Error: "la enfermedad ya existe"})
+	if msg := validateDiseaseSyms(in.Symptoms); msg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(apiError{Error: msg})
 		return
 	}
-	for _, s := range in.Symptoms {
-		ws := strconv.FormatFloat(s.Weight, 'g', -1, 64)
-		_, _ = Create3(predDisSym, in.ID, s.ID, ws)
+	var out DiseaseOut
+	err := KBApply(r.Context(), func(tx *KBTx) error {
+		d, err := tx.Assert(predDiseases, in.ID, in.Name)
+		if err != nil {
+			return err
+		}
+		if err := addDiseaseSymptoms(tx, d.Args[0], in.Symptoms); err != nil {
+			return err
+		}
+		out = DiseaseOut{ID: d.Args[0], Name: d.Args[1], Symptoms: readDiseaseSymptoms(tx.Facts(predDisSym), d.Args[0])}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, errKBExists) {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(apiError{Error: "la enfermedad ya existe"})
+			return
+		}
+		writeKBError(w, err)
+		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(DiseaseOut{ID: toAtom(in.ID), Name: toAtom(in.Name), Symptoms: in.Symptoms})
+	json.NewEncoder(w).Encode(out)
 }
 
 func UpdateDisease(w http.ResponseWriter, r *http.Request) {
@@ -121,9 +139,27 @@ func UpdateDisease(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(apiError{Error: "id y name son obligatorios"})
 		return
 	}
-	oldName := getDiseaseName(oldID)
-	if _, ok, why := Update2(predDiseases, oldID, oldName, in.ID, in.Name); !ok {
-		switch why {
+	if msg := validateDiseaseSyms(in.Symptoms); msg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(apiError{Error: msg})
+		return
+	}
+	var out DiseaseOut
+	err := KBApply(r.Context(), func(tx *KBTx) error {
+		d, err := tx.Update(predDiseases, []string{oldID, getDiseaseName(tx, oldID)}, []string{in.ID, in.Name})
+		if err != nil {
+			return err
+		}
+		if in.Symptoms != nil {
+			if err := replaceDiseaseSymptoms(tx, d.Args[0], in.Symptoms); err != nil {
+				return err
+			}
+		}
+		out = DiseaseOut{ID: d.Args[0], Name: d.Args[1]}
+		return nil
+	})
+	if err != nil {
+		switch kbWhy(err) {
 		case "not_found":
 			w.WriteHeader(http.StatusNotFound)
 			json.NewEncoder(w).Encode(apiError{Error: "no existe la enfermedad a actualizar"})
@@ -131,19 +167,14 @@ func UpdateDisease(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusConflict)
 			json.NewEncoder(w).Encode(apiError{Error: "ya existe una enfermedad con ese id/nombre"})
 		default:
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(apiError{Error: "error en actualización"})
+			writeKBError(w, err)
 		}
 		return
 	}
-	if toAtom(oldID) != toAtom(in.ID) {
-		renameDiseaseInTriples(oldID, in.ID)
-	}
-	if in.Symptoms != nil {
-		replaceDiseaseSymptoms(in.ID, in.Symptoms)
-	}
+	// los renombres se propagan al confirmar, por eso se lee después
+	out.Symptoms = readDiseaseSymptoms(KBList(predDisSym), out.ID)
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(DiseaseOut{ID: toAtom(in.ID), Name: toAtom(in.Name), Symptoms: readDiseaseSymptoms(in.ID)})
+	json.NewEncoder(w).Encode(out)
 }
 
 func DeleteDisease(w http.ResponseWriter, r *http.Request) {
@@ -159,64 +190,95 @@ func DeleteDisease(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	id := parts[2]
-	if !Delete2(predDiseases, id, getDiseaseName(id)) {
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(apiError{Error: "no existe la enfermedad"})
+	err := KBApply(r.Context(), func(tx *KBTx) error {
+		_, err := tx.Retract(predDiseases, id, getDiseaseName(tx, id))
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, errKBNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(apiError{Error: "no existe la enfermedad"})
+			return
+		}
+		writeKBError(w, err)
 		return
 	}
-	deleteAllDiseaseTriples(id)
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func getDiseaseName(id string) string {
+// validateDiseaseSyms exige pesos en (0, 1]; devuelve el mensaje de error o "".
+func validateDiseaseSyms(list []DiseaseSym) string {
+	for _, s := range list {
+		if !(s.Weight > 0 && s.Weight <= 1) {
+			return "el peso de " + toAtom(s.ID) + " debe estar en (0, 1]"
+		}
+	}
+	return ""
+}
+
+func getDiseaseName(tx *KBTx, id string) string {
 	id = toAtom(id)
-	for _, p := range List2(predDiseases) {
-		if p[0] == id {
-			return p[1]
+	for _, f := range tx.Facts(predDiseases) {
+		if f.Args[0] == id {
+			return f.Args[1]
 		}
 	}
 	return ""
 }
 
-func readDiseaseSymptoms(diseaseID string) []DiseaseSym {
+func readDiseaseSymptoms(triples []Fact, diseaseID string) []DiseaseSym {
 	diseaseID = toAtom(diseaseID)
 	var syms []DiseaseSym
-	for _, t := range List3(predDisSym) {
-		if t[0] == diseaseID {
-			wf, _ := strconv.ParseFloat(t[2], 64)
-			syms = append(syms, DiseaseSym{ID: t[1], Weight: wf})
+	for _, f := range triples {
+		if f.Args[0] == diseaseID {
+			wf, _ := strconv.ParseFloat(f.Args[2], 64)
+			syms = append(syms, DiseaseSym{ID: f.Args[1], Weight: wf})
 		}
 	}
 	return syms
 }
 
-func deleteAllDiseaseTriples(diseaseID string) {
-	diseaseID = toAtom(diseaseID)
-	for _, t := range List3(predDisSym) {
-		if t[0] == diseaseID {
-			_ = Delete3(predDisSym, t[0], t[1], t[2])
+func addDiseaseSymptoms(tx *KBTx, diseaseID string, list []DiseaseSym) error {
+	for _, s := range list {
+		ws := strconv.FormatFloat(s.Weight, 'g', -1, 64)
+		if _, err := tx.Assert(predDisSym, diseaseID, s.ID, ws); err != nil && !errors.Is(err, errKBExists) {
+			return err
 		}
 	}
+	return nil
 }
 
-func replaceDiseaseSymptoms(diseaseID string, list []DiseaseSym) {
+// replaceDiseaseSymptoms deja a la enfermedad con los síntomas de list. Los
+// que ya tenía y solo cambian de peso se actualizan, así la auditoría los
+// registra como update y no como baja y alta.
+func replaceDiseaseSymptoms(tx *KBTx, diseaseID string, list []DiseaseSym) error {
 	diseaseID = toAtom(diseaseID)
-	deleteAllDiseaseTriples(diseaseID)
+	want := map[string]string{}
 	for _, s := range list {
-		ws := strconv.FormatFloat(s.Weight, 'g', -1, 64)
-		_, _ = Create3(predDisSym, diseaseID, s.ID, ws)
+		want[toAtom(s.ID)] = strconv.FormatFloat(s.Weight, 'g', -1, 64)
 	}
-}
-
-func renameDiseaseInTriples(oldID, newID string) {
-	oldID = toAtom(oldID)
-	newID = toAtom(newID)
-	for _, t := range List3(predDisSym) {
-		if t[0] == oldID {
-			_, ok, _ := Update3(predDisSym, t[0], t[1], t[2], newID, t[1], t[2])
-			if !ok {
-				_ = Delete3(predDisSym, t[0], t[1], t[2])
+	kept := map[string]bool{}
+	for _, f := range tx.Facts(predDisSym) {
+		if f.Args[0] != diseaseID {
+			continue
+		}
+		ws, ok := want[f.Args[1]]
+		if !ok || kept[f.Args[1]] {
+			if _, err := tx.Retract(predDisSym, f.Args...); err != nil {
+				return err
 			}
+			continue
+		}
+		kept[f.Args[1]] = true
+		if _, err := tx.Update(predDisSym, f.Args, []string{f.Args[0], f.Args[1], ws}); err != nil {
+			return err
+		}
+	}
+	var added []DiseaseSym
+	for _, s := range list {
+		if !kept[toAtom(s.ID)] {
+			added = append(added, s)
 		}
 	}
+	return addDiseaseSymptoms(tx, diseaseID, added)
 }
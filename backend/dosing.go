@@ -0,0 +1,75 @@
+package main
+
+import "strconv"
+
+const (
+	predDose     = "dosis"
+	predRenalAdj = "ajuste_renal"
+	fileDosing   = "prolog.pl"
+)
+
+// dosis(Med, Grupo, MgKg, MaxDosisMg, MaxDiariaMg, IntervaloH): MgKg 0 indica
+// dosis fija (MaxDosisMg). ajuste_renal(Med, ClCrLimite, Factor) multiplica la
+// dosis cuando el aclaramiento es menor al límite; Factor 0 lo contraindica.
+var (
+	schemaDose     = []ArgType{ArgAtom, ArgAtom, ArgNumber, ArgNumber, ArgNumber, ArgNumber}
+	schemaRenalAdj = []ArgType{ArgAtom, ArgNumber, ArgNumber}
+)
+
+type DxDose struct {
+	AgeGroup      string  `json:"ageGroup"`
+	DoseMg        float64 `json:"doseMg"`
+	IntervalHours float64 `json:"intervalHours"`
+	DailyMg       float64 `json:"dailyMg"`
+	RenalFactor   float64 `json:"renalFactor"`
+	Text          string  `json:"text"`
+}
+
+func InitDosing() error {
+	if err := KBRegister(PredSchema{Name: predDose, Types: schemaDose}, fileDosing); err != nil {
+		return err
+	}
+	return KBRegister(PredSchema{Name: predRenalAdj, Types: schemaRenalAdj}, fileDosing)
+}
+
+// demographicsTerm arma datos(Edad, Peso, ClCr) con desconocido para la edad
+// y 0 para peso y aclaramiento cuando no se conocen. Los negativos se tratan
+// como desconocidos: golog no evalúa el menos unario.
+func demographicsTerm(d *DxDemographics) string {
+	num := func(v *float64) string {
+		if v == nil || *v < 0 {
+			return "0"
+		}
+		return strconv.FormatFloat(*v, 'f', -1, 64)
+	}
+	if d == nil {
+		return "datos(desconocido,0,0)"
+	}
+	age := "desconocido"
+	if d.AgeYears != nil && *d.AgeYears >= 0 {
+		age = num(d.AgeYears)
+	}
+	return "datos(" + age + "," + num(d.WeightKg) + "," + num(d.CreatinineClearance) + ")"
+}
+
+// computeDose consulta dosis_recomendada/7; devuelve nil si faltan datos
+// (edad, o peso para una dosis por kg) o no hay hechos de dosis.
+func computeDose(kb kbView, medID, datos string) *DxDose {
+	sols := kb.ProveAll("dosis_recomendada(" + plAtom(medID) + "," + datos + ",G,D,I,T,F).")
+	if len(sols) == 0 {
+		return nil
+	}
+	s := sols[0]
+	d := &DxDose{
+		AgeGroup:      plAtomOf(s.ByName_("G")),
+		DoseMg:        round2dx(plNumberOf(s.ByName_("D"))),
+		IntervalHours: round2dx(plNumberOf(s.ByName_("I"))),
+		DailyMg:       round2dx(plNumberOf(s.ByName_("T"))),
+		RenalFactor:   round2dx(plNumberOf(s.ByName_("F"))),
+	}
+	d.Text = trimFloat(d.DoseMg) + " mg cada " + trimFloat(d.IntervalHours) + " h (máx. " + trimFloat(d.DailyMg) + " mg/día)"
+	if d.RenalFactor != 1 {
+		d.Text += ", ajuste renal x" + trimFloat(d.RenalFactor)
+	}
+	return d
+}
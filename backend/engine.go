@@ -1,23 +1,69 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"io/fs"
 	"os"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
 
 	golog "github.com/mndrix/golog"
+	"github.com/mndrix/golog/term"
 )
 
 var (
-	plMutex    sync.Mutex
-	plMachine  golog.Machine
-	plFacts    = map[string]map[string]bool{} // predicado -> set de átomos
-	plFiles    = map[string]string{}          // predicado -> archivo
+	plMutex   sync.Mutex
+	plMachine golog.Machine
+	kbSchemas = map[string]PredSchema{}      // predicado -> esquema
+	kbFacts   = map[string]map[string]Fact{} // predicado -> clave -> hecho
+	kbStores  = map[string]FactStore{}       // predicado -> almacén
+	kbOpened  = map[string]FactStore{}       // archivo -> almacén
 )
 
+var (
+	errKBUnknownPred = errors.New("predicado no registrado")
+	errKBBadArgs     = errors.New("argumentos inválidos")
+	errKBExists      = errors.New("el hecho ya existe")
+	errKBNotFound    = errors.New("no existe el hecho")
+	// el cambio quedó en los almacenes pero no en la versión o la auditoría
+	errKBUnlogged = errors.New("el cambio se guardó pero no se pudo registrar en la auditoría")
+)
+
+// golog no trae member/2 ni comparaciones aritméticas; se definen aquí para
+// que prolog.pl siga siendo compatible con SWI-Prolog.
+const plPrelude = `
+member(X, [X|_]).
+member(X, [_|T]) :- member(X, T).
+`
+
+var plForeign = map[string]golog.ForeignPredicate{
+	"</2":    plCompare(func(c int) bool { return c < 0 }),
+	">/2":    plCompare(func(c int) bool { return c > 0 }),
+	"=</2":   plCompare(func(c int) bool { return c <= 0 }),
+	">=/2":   plCompare(func(c int) bool { return c >= 0 }),
+	"=\\=/2": plCompare(func(c int) bool { return c != 0 }),
+}
+
+func plCompare(ok func(int) bool) golog.ForeignPredicate {
+	return func(m golog.Machine, args []term.Term) golog.ForeignReturn {
+		a, err := term.ArithmeticEval(args[0])
+		if err != nil {
+			panic(err)
+		}
+		b, err := term.ArithmeticEval(args[1])
+		if err != nil {
+			panic(err)
+		}
+		if ok(term.NumberCmp(a, b)) {
+			return golog.ForeignTrue()
+		}
+		return golog.ForeignFail()
+	}
+}
+
 func toAtom(s string) string {
 	s = strings.ToLower(strings.TrimSpace(s))
 	re := regexp.MustCompile(`[^\p{L}\p{N}_]+`)
@@ -28,128 +74,246 @@ func toAtom(s string) string {
 	return s
 }
 
+// plNumberLit es un número escrito como en Prolog; plAtomRaw son los átomos
+// que golog lee igual sin comillas: identificadores en minúscula y números,
+// que es como se escriben también en los hechos.
+var (
+	plNumberLit = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?([eE][-+]?[0-9]+)?$`)
+	plAtomRaw   = regexp.MustCompile(`^[a-z][A-Za-z0-9_]*$`)
+)
+
+// plAtom escribe s como átomo para una consulta o una cláusula. Lo que no es
+// un identificador simple va entre comillas, así un id como "1abc" no rompe
+// la consulta y "_" no se vuelve una variable.
+func plAtom(s string) string {
+	if plAtomRaw.MatchString(s) || plNumberLit.MatchString(s) {
+		return s
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+// plBuildProgram escribe los hechos administrados. Cada predicado registrado
+// lleva además una cláusula que falla: golog ignora ":- dynamic" y una
+// consulta a un predicado sin cláusulas entra en pánico.
 func plBuildProgram() string {
 	var b strings.Builder
-	for pred, set := range plFacts {
-		for id := range set {
-			b.WriteString(pred)
-			b.WriteString("(")
-			b.WriteString(id)
-			b.WriteString(").\n")
+	for _, pred := range sortedKeys(kbSchemas) {
+		vars := strings.TrimSuffix(strings.Repeat("_,", kbSchemas[pred].Arity()), ",")
+		b.WriteString(pred + "(" + vars + ") :- fail.\n")
+	}
+	for _, pred := range sortedKeys(kbFacts) {
+		for _, key := range sortedKeys(kbFacts[pred]) {
+			b.WriteString(kbFacts[pred][key].Clause())
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+// plBuildRules devuelve las cláusulas de los almacenes que no son hechos
+// administrados (reglas y tablas auxiliares).
+func plBuildRules() string {
+	var b strings.Builder
+	for _, file := range sortedKeys(kbOpened) {
+		for _, cl := range kbOpened[file].Rules(kbManaged) {
+			b.WriteString(cl)
+			b.WriteByte('\n')
 		}
 	}
 	return b.String()
 }
 
 func plRebuildMachine() {
-	code := plBuildProgram()
-	plMachine = golog.NewMachine().Consult(code)
+	code := plPrelude + plBuildProgram() + plBuildRules()
+	plMachine = golog.NewMachine().RegisterForeign(plForeign).Consult(code)
 }
 
-func plSave(pred string) error {
-	file, ok := plFiles[pred]
-	if !ok || file == "" {
-		return nil
+func kbManaged(pred string, arity int) bool {
+	s, ok := kbSchemas[pred]
+	return ok && s.Arity() == arity
+}
+
+func kbStoreFor(file string) (FactStore, error) {
+	if st, ok := kbOpened[file]; ok {
+		return st, nil
 	}
-	var b strings.Builder
-	for id := range plFacts[pred] {
-		b.WriteString(pred)
-		b.WriteString("(")
-		b.WriteString(id)
-		b.WriteString(").\n")
+	st, err := kbOpenStore(file)
+	if err != nil {
+		return nil, err
 	}
-	return os.WriteFile(file, []byte(b.String()), fs.FileMode(0644))
+	kbOpened[file] = st
+	return st, nil
 }
 
-func PLRegisterPredicate(pred string, file string) error {
+// kbNormalize convierte los argumentos crudos según el esquema del predicado.
+func kbNormalize(schema PredSchema, raw []string) (Fact, error) {
+	if len(raw) != schema.Arity() {
+		return Fact{}, fmt.Errorf("%w: %s espera %d argumentos", errKBBadArgs, schema.Indicator(), schema.Arity())
+	}
+	args := make([]string, len(raw))
+	for i, r := range raw {
+		switch schema.Types[i] {
+		case ArgNumber:
+			n, ok := normalizeNumber(r)
+			if !ok {
+				return Fact{}, fmt.Errorf("%w: %q no es un número", errKBBadArgs, r)
+			}
+			args[i] = n
+		default:
+			args[i] = toAtom(trimQuotes(r))
+		}
+	}
+	return Fact{Pred: schema.Name, Args: args}, nil
+}
+
+// KBRegister declara un predicado, carga sus hechos desde el almacén del
+// archivo y reconstruye la máquina.
+func KBRegister(schema PredSchema, file string) error {
+	kbWriteMu.Lock()
+	defer kbWriteMu.Unlock()
 	plMutex.Lock()
 	defer plMutex.Unlock()
-
-	if _, ok := plFacts[pred]; !ok {
-		plFacts[pred] = map[string]bool{}
-	}
-	plFiles[pred] = file
-
-	src, err := os.ReadFile(file)
-	if err == nil {
-		lines := strings.Split(string(src), "\n")
-		prefix := pred + "("
-		for _, ln := range lines {
-			ln = strings.TrimSpace(ln)
-			if strings.HasPrefix(ln, prefix) && strings.HasSuffix(ln, ").") {
-				body := ln[len(prefix) : len(ln)-2]
-				id := toAtom(body)
-				if id != "" {
-					plFacts[pred][id] = true
-				}
-			}
+	st, err := kbStoreFor(file)
+	if err != nil {
+		return err
+	}
+	facts, err := st.Load(schema)
+	if err != nil {
+		return err
+	}
+	set := map[string]Fact{}
+	for _, f := range facts {
+		if nf, err := kbNormalize(schema, f.Args); err == nil {
+			set[nf.Key()] = nf
 		}
 	}
+	kbSchemas[schema.Name] = schema
+	kbFacts[schema.Name] = set
+	kbStores[schema.Name] = st
 	plRebuildMachine()
 	return nil
 }
 
-func PLList(pred string) []string {
+func KBList(pred string) []Fact {
 	plMutex.Lock()
 	defer plMutex.Unlock()
-	q := pred + "(Id)."
-	sols := plMachine.ProveAll(q)
-	out := make([]string, 0, len(sols))
-	for _, s := range sols {
-		out = append(out, fmt.Sprint(s.ByName_("Id")))
+	set := kbFacts[pred]
+	out := make([]Fact, 0, len(set))
+	for _, k := range sortedKeys(set) {
+		out = append(out, set[k])
 	}
 	return out
 }
 
-func PLCreate(pred, raw string) (string, bool) {
+func KBCreate(ctx context.Context, pred string, raw ...string) (f Fact, err error) {
+	err = KBApply(ctx, func(tx *KBTx) error {
+		f, err = tx.Assert(pred, raw...)
+		return err
+	})
+	return f, err
+}
+
+func KBDelete(ctx context.Context, pred string, raw ...string) (f Fact, err error) {
+	err = KBApply(ctx, func(tx *KBTx) error {
+		f, err = tx.Retract(pred, raw...)
+		return err
+	})
+	return f, err
+}
+
+func KBUpdate(ctx context.Context, pred string, oldRaw, newRaw []string) (f Fact, err error) {
+	err = KBApply(ctx, func(tx *KBTx) error {
+		f, err = tx.Update(pred, oldRaw, newRaw)
+		return err
+	})
+	return f, err
+}
+
+// kbView es una máquina junto con la versión de la base que la generó, leídas
+// juntas bajo plMutex. Las máquinas de golog son inmutables: quien toma una
+// vista (p. ej. un diagnóstico) puede hacer todas sus consultas sobre ella
+// aunque entretanto se confirme otra versión.
+type kbView struct {
+	m       golog.Machine
+	Version int
+}
+
+func kbCurrent() kbView {
 	plMutex.Lock()
 	defer plMutex.Unlock()
-	id := toAtom(raw)
-	if id == "" {
-		id = "x"
-	}
-	if _, ok := plFacts[pred]; !ok {
-		plFacts[pred] = map[string]bool{}
+	return kbView{m: plMachine, Version: kbVersion}
+}
+
+// ProveAll consulta la máquina de la vista sin retener ningún candado.
+func (v kbView) ProveAll(goal string) (sols []term.Bindings) {
+	// golog entra en pánico ante una consulta mal formada; se trata como una
+	// consulta sin soluciones en vez de cortar la conexión
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Fprintf(os.Stderr, "prolog: %v en %q\n", r, goal)
+			sols = nil
+		}
+	}()
+	return v.m.ProveAll(goal)
+}
+
+func plAtomOf(t term.Term) string {
+	if c, ok := t.(term.Callable); ok {
+		return c.Name()
 	}
-	if plFacts[pred][id] {
-		return id, false
+	return fmt.Sprint(t)
+}
+
+func plNumberOf(t term.Term) float64 {
+	if n, ok := t.(term.Number); ok {
+		return n.Float64()
 	}
-	plFacts[pred][id] = true
-	plRebuildMachine()
-	_ = plSave(pred)
-	return id, true
+	return 0
 }
 
-func PLDelete(pred, raw string) bool {
-	plMutex.Lock()
-	defer plMutex.Unlock()
-	id := toAtom(raw)
-	if _, ok := plFacts[pred]; !ok || !plFacts[pred][id] {
-		return false
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
 	}
-	delete(plFacts[pred], id)
-	plRebuildMachine()
-	_ = plSave(pred)
-	return true
+	sort.Strings(keys)
+	return keys
 }
 
-func PLUpdate(pred, oldRaw, newRaw string) (string, bool, string) {
-	plMutex.Lock()
-	defer plMutex.Unlock()
-	oldID := toAtom(oldRaw)
-	newID := toAtom(newRaw)
-	if _, ok := plFacts[pred]; !ok || !plFacts[pred][oldID] {
-		return "", false, "not_found"
+func PLRegisterPredicate(pred string, file string) error {
+	return KBRegister(PredSchema{Name: pred, Types: []ArgType{ArgAtom}}, file)
+}
+
+func PLList(pred string) []string {
+	sols := kbCurrent().ProveAll(pred + "(Id).")
+	out := make([]string, 0, len(sols))
+	for _, s := range sols {
+		out = append(out, fmt.Sprint(s.ByName_("Id")))
 	}
-	if newID == oldID {
-		return newID, true, ""
+	return out
+}
+
+func PLCreate(ctx context.Context, pred, raw string) (string, error) {
+	f, err := KBCreate(ctx, pred, raw)
+	return factArg(f, 0), err
+}
+
+// kbWhy traduce los errores del motor a los códigos que usan los handlers.
+func kbWhy(err error) string {
+	switch {
+	case errors.Is(err, errKBNotFound):
+		return "not_found"
+	case errors.Is(err, errKBExists):
+		return "conflict"
+	case errors.Is(err, errKBBadArgs):
+		return "bad_number"
 	}
-	if plFacts[pred][newID] {
-		return "", false, "conflict"
+	return "error"
+}
+
+func factArg(f Fact, i int) string {
+	if i < len(f.Args) {
+		return f.Args[i]
 	}
-	delete(plFacts[pred], oldID)
-	plFacts[pred][newID] = true
-	plRebuildMachine()
-	_ = plSave(pred)
-	return newID, true, ""
+	return ""
 }
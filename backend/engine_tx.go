@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// kbWriteMu serializa las transacciones de escritura. plMutex solo se toma al
+// publicar el resultado, así las consultas no esperan a que termine una
+// edición larga.
+var kbWriteMu sync.Mutex
+
+// KBTx agrupa cambios sobre cualquier predicado registrado. Mientras está
+// abierta ve sus propios cambios; en Commit se persisten de una vez y la
+// máquina se reconstruye una sola vez. Rollback los descarta.
+type KBTx struct {
+	ops    []factOp
+	work   map[string]map[string]Fact // predicado -> copia con los cambios
+	audit  []AuditEntry
+	actor  string
+	note   string
+	closed bool
+}
+
+// KBBegin abre una transacción a nombre de la sesión que trae ctx; ese es el
+// actor que queda en la auditoría.
+func KBBegin(ctx context.Context) *KBTx {
+	kbWriteMu.Lock()
+	return &KBTx{work: map[string]map[string]Fact{}, actor: actorOf(ctx)}
+}
+
+// KBApply ejecuta fn dentro de una transacción: si fn devuelve error (o entra
+// en pánico) se descartan todos sus cambios, si no se confirman.
+func KBApply(ctx context.Context, fn func(tx *KBTx) error) error {
+	tx := KBBegin(ctx)
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (tx *KBTx) set(pred string) (map[string]Fact, error) {
+	if s, ok := tx.work[pred]; ok {
+		return s, nil
+	}
+	if _, ok := kbSchemas[pred]; !ok {
+		return nil, errKBUnknownPred
+	}
+	s := make(map[string]Fact, len(kbFacts[pred]))
+	for k, f := range kbFacts[pred] {
+		s[k] = f
+	}
+	tx.work[pred] = s
+	return s, nil
+}
+
+func (tx *KBTx) normalize(pred string, raw []string) (Fact, map[string]Fact, error) {
+	if tx.closed {
+		return Fact{}, nil, errTxClosed
+	}
+	set, err := tx.set(pred)
+	if err != nil {
+		return Fact{}, nil, err
+	}
+	f, err := kbNormalize(kbSchemas[pred], raw)
+	return f, set, err
+}
+
+// Facts devuelve los hechos del predicado tal como quedarían al confirmar.
+func (tx *KBTx) Facts(pred string) []Fact {
+	set, err := tx.set(pred)
+	if err != nil {
+		return nil
+	}
+	out := make([]Fact, 0, len(set))
+	for _, k := range sortedKeys(set) {
+		out = append(out, set[k])
+	}
+	return out
+}
+
+func (tx *KBTx) Has(pred string, raw ...string) bool {
+	f, set, err := tx.normalize(pred, raw)
+	if err != nil {
+		return false
+	}
+	_, ok := set[f.Key()]
+	return ok
+}
+
+func (tx *KBTx) Assert(pred string, raw ...string) (Fact, error) {
+	f, set, err := tx.normalize(pred, raw)
+	if err != nil {
+		return Fact{}, err
+	}
+	if _, ok := set[f.Key()]; ok {
+		return f, errKBExists
+	}
+	if idTaken(pred, set, f.Args[0], "") {
+		return f, errKBExists
+	}
+	set[f.Key()] = f
+	tx.ops = append(tx.ops, factOp{Fact: f, Assert: true})
+	tx.record(auditCreate, nil, &f)
+	return f, nil
+}
+
+func (tx *KBTx) Retract(pred string, raw ...string) (Fact, error) {
+	f, set, err := tx.normalize(pred, raw)
+	if err != nil {
+		return Fact{}, err
+	}
+	if _, ok := set[f.Key()]; !ok {
+		return f, errKBNotFound
+	}
+	delete(set, f.Key())
+	tx.ops = append(tx.ops, factOp{Fact: f})
+	tx.record(auditDelete, &f, nil)
+	return f, nil
+}
+
+func (tx *KBTx) Update(pred string, oldRaw, newRaw []string) (Fact, error) {
+	o, set, err := tx.normalize(pred, oldRaw)
+	if err != nil {
+		return Fact{}, err
+	}
+	n, _, err := tx.normalize(pred, newRaw)
+	if err != nil {
+		return Fact{}, err
+	}
+	if _, ok := set[o.Key()]; !ok {
+		return Fact{}, errKBNotFound
+	}
+	if o.Key() == n.Key() {
+		return n, nil
+	}
+	if _, ok := set[n.Key()]; ok {
+		return Fact{}, errKBExists
+	}
+	if idTaken(pred, set, n.Args[0], o.Key()) {
+		return Fact{}, errKBExists
+	}
+	delete(set, o.Key())
+	set[n.Key()] = n
+	tx.ops = append(tx.ops, factOp{Fact: o}, factOp{Fact: n, Assert: true})
+	tx.record(auditUpdate, &o, &n)
+	if o.Args[0] != n.Args[0] {
+		if err := tx.propagateRename(pred, o.Args[0], n.Args[0]); err != nil {
+			return Fact{}, err
+		}
+	}
+	return n, nil
+}
+
+// Commit valida la integridad referencial, persiste los cambios agrupados
+// por almacén y publica el nuevo conjunto de hechos. Si algo falla no se
+// publica nada.
+func (tx *KBTx) Commit() error {
+	if tx.closed {
+		return errTxClosed
+	}
+	if len(tx.ops) == 0 {
+		tx.Rollback()
+		return nil
+	}
+	if err := tx.enforceRefs(); err != nil {
+		tx.Rollback()
+		return err
+	}
+	tx.closed = true
+	defer kbWriteMu.Unlock()
+
+	byStore := map[FactStore][]factOp{}
+	var stores []FactStore
+	for _, op := range tx.ops {
+		st := kbStores[op.Fact.Pred]
+		if _, ok := byStore[st]; !ok {
+			stores = append(stores, st)
+		}
+		byStore[st] = append(byStore[st], op)
+	}
+	// primero se preparan todos los almacenes (archivos temporales) y solo si
+	// todos pudieron se renombran; un fallo al preparar no deja nada a medias
+	stxs := make([]FactTx, 0, len(stores))
+	for _, st := range stores {
+		stx := st.Begin()
+		for _, op := range byStore[st] {
+			if op.Assert {
+				stx.Assert(op.Fact)
+			} else {
+				stx.Retract(op.Fact)
+			}
+		}
+		stxs = append(stxs, stx)
+		if err := stx.Prepare(); err != nil {
+			for _, p := range stxs {
+				p.Rollback()
+			}
+			return err
+		}
+	}
+	for i, stx := range stxs {
+		if err := stx.Commit(); err != nil {
+			for _, p := range stxs[i+1:] {
+				p.Rollback()
+			}
+			return err
+		}
+	}
+
+	// la versión y la auditoría describen lo que ya quedó en los almacenes.
+	// Si no se pueden escribir, el cambio igual se publica, porque ya está en
+	// disco, y se informa el error. Una transacción que no cambia nada neto
+	// no crea versión.
+	version := kbVersion
+	var logErr error
+	if entries := compactAudit(tx.audit); len(entries) > 0 {
+		if v, err := tx.snapshot(); err != nil {
+			logErr = err
+		} else {
+			version = v
+		}
+		if err := appendAudit(entries, version); err != nil && logErr == nil {
+			logErr = err
+		}
+	}
+
+	plMutex.Lock()
+	defer plMutex.Unlock()
+	for pred, set := range tx.work {
+		kbFacts[pred] = set
+	}
+	kbVersion = version
+	plRebuildMachine()
+	if logErr != nil {
+		return fmt.Errorf("%w: %v", errKBUnlogged, logErr)
+	}
+	return nil
+}
+
+func (tx *KBTx) Rollback() {
+	if tx.closed {
+		return
+	}
+	tx.closed = true
+	tx.ops = nil
+	tx.work = nil
+	tx.audit = nil
+	kbWriteMu.Unlock()
+}
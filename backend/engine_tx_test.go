@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+var errDiskFull = errors.New("disco lleno")
+
+// failingStore es un almacén cuyo Prepare siempre falla.
+type failingStore struct{}
+
+func (failingStore) Load(PredSchema) ([]Fact, error)       { return nil, nil }
+func (failingStore) Rules(func(string, int) bool) []string { return nil }
+func (failingStore) Begin() FactTx {
+	return &opTx{prepare: func([]factOp) (stagedWrite, error) { return stagedWrite{}, errDiskFull }}
+}
+
+// TestKBTxCommit comprueba que una transacción publique todos sus cambios o
+// ninguno, tanto en la memoria del motor como en el almacén y la máquina.
+func TestKBTxCommit(t *testing.T) {
+	tests := []struct {
+		name    string
+		fn      func(tx *KBTx) error
+		wantErr error
+		applied bool
+	}{
+		{
+			name: "confirma y publica",
+			fn: func(tx *KBTx) error {
+				_, err := tx.Assert(predSymptoms, "prueba_tx")
+				return err
+			},
+			applied: true,
+		},
+		{
+			name: "un error de la función descarta todo",
+			fn: func(tx *KBTx) error {
+				if _, err := tx.Assert(predSymptoms, "prueba_tx"); err != nil {
+					return err
+				}
+				_, err := tx.Assert(predSymptoms, "fiebre")
+				return err
+			},
+			wantErr: errKBExists,
+		},
+		{
+			name: "un almacén que falla al preparar no deja nada a medias",
+			fn: func(tx *KBTx) error {
+				if _, err := tx.Assert(predSymptoms, "prueba_tx"); err != nil {
+					return err
+				}
+				_, err := tx.Assert("prueba_falla", "x")
+				return err
+			},
+			wantErr: errDiskFull,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			freshKB(t)
+			kbWriteMu.Lock()
+			kbSchemas["prueba_falla"] = PredSchema{Name: "prueba_falla", Types: []ArgType{ArgAtom}}
+			kbFacts["prueba_falla"] = map[string]Fact{}
+			kbStores["prueba_falla"] = failingStore{}
+			kbWriteMu.Unlock()
+			version := KBVersion()
+
+			err := KBApply(context.Background(), tt.fn)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, se esperaba %v", err, tt.wantErr)
+			}
+
+			want := Fact{Pred: predSymptoms, Args: []string{"prueba_tx"}}
+			inEngine := false
+			for _, f := range KBList(predSymptoms) {
+				inEngine = inEngine || f.Key() == want.Key()
+			}
+			stored, _ := kbStores[predSymptoms].Load(kbSchemas[predSymptoms])
+			inStore := false
+			for _, f := range stored {
+				inStore = inStore || f.Key() == want.Key()
+			}
+			inMachine := len(kbCurrent().ProveAll("sintoma(prueba_tx).")) > 0
+			if inEngine != tt.applied || inStore != tt.applied || inMachine != tt.applied {
+				t.Errorf("motor=%v almacén=%v máquina=%v, se esperaba %v", inEngine, inStore, inMachine, tt.applied)
+			}
+			if tt.applied != (KBVersion() > version) {
+				t.Errorf("versión %d -> %d", version, KBVersion())
+			}
+
+			// la transacción tiene que haber soltado el candado de escritura
+			if !kbWriteMu.TryLock() {
+				t.Fatal("kbWriteMu quedó tomado")
+			}
+			kbWriteMu.Unlock()
+		})
+	}
+}
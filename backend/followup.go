@@ -0,0 +1,116 @@
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	// followUpCandidates es cuántos de los primeros resultados se intentan
+	// separar con las preguntas.
+	followUpCandidates = 3
+	followUpMax        = 3
+)
+
+// DxQuestion es un síntoma por el que conviene preguntar. InformationGain es
+// la ganancia esperada en bits sobre los candidatos; Favors lista las
+// enfermedades que suben si la respuesta es sí.
+type DxQuestion struct {
+	SymptomID       string   `json:"symptomId"`
+	InformationGain float64  `json:"informationGain"`
+	Favors          []string `json:"favors"`
+}
+
+func entropy(ps []float64) float64 {
+	h := 0.0
+	for _, p := range ps {
+		if p > 0 {
+			h -= p * math.Log2(p)
+		}
+	}
+	return h
+}
+
+// followUpQuestions elige los síntomas todavía no preguntados que más
+// información aportan entre los primeros candidatos. Toma la afinidad
+// normalizada como probabilidad previa y el peso de enfermedad_sintoma/3 como
+// probabilidad de que el síntoma esté presente en cada enfermedad.
+func followUpQuestions(kb kbView, in DiagnosisIn, results []DxResult) []DxQuestion {
+	var cands []DxResult
+	total := 0.0
+	for _, r := range results {
+		if r.Affinity <= 0 || len(cands) == followUpCandidates {
+			break
+		}
+		cands = append(cands, r)
+		total += r.Affinity
+	}
+	if len(cands) < 2 {
+		return nil
+	}
+	asked := map[string]bool{}
+	for _, s := range in.Symptoms {
+		asked[toAtom(s.ID)] = true
+	}
+	for _, s := range in.DeniedSymptoms {
+		asked[toAtom(s)] = true
+	}
+
+	prior := make([]float64, len(cands))
+	weights := map[string][]float64{}
+	for i, c := range cands {
+		prior[i] = c.Affinity / total
+		for _, s := range kb.ProveAll("enfermedad_sintoma(" + plAtom(c.DiseaseID) + ",S,W).") {
+			sid := plAtomOf(s.ByName_("S"))
+			if asked[sid] {
+				continue
+			}
+			if weights[sid] == nil {
+				weights[sid] = make([]float64, len(cands))
+			}
+			weights[sid][i] = math.Min(plNumberOf(s.ByName_("W")), 1)
+		}
+	}
+
+	h0 := entropy(prior)
+	var out []DxQuestion
+	for sid, w := range weights {
+		yes, no := make([]float64, len(cands)), make([]float64, len(cands))
+		pYes := 0.0
+		for i := range cands {
+			yes[i] = prior[i] * w[i]
+			no[i] = prior[i] * (1 - w[i])
+			pYes += yes[i]
+		}
+		pNo := 1 - pYes
+		for i := range cands {
+			if pYes > 0 {
+				yes[i] /= pYes
+			}
+			if pNo > 0 {
+				no[i] /= pNo
+			}
+		}
+		gain := h0 - pYes*entropy(yes) - pNo*entropy(no)
+		if gain <= 1e-9 {
+			continue
+		}
+		q := DxQuestion{SymptomID: sid, InformationGain: math.Round(gain*1000) / 1000}
+		for i, c := range cands {
+			if yes[i] > prior[i] {
+				q.Favors = append(q.Favors, c.DiseaseID)
+			}
+		}
+		out = append(out, q)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].InformationGain != out[j].InformationGain {
+			return out[i].InformationGain > out[j].InformationGain
+		}
+		return out[i].SymptomID < out[j].SymptomID
+	})
+	if len(out) > followUpMax {
+		out = out[:followUpMax]
+	}
+	return out
+}
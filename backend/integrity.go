@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+const (
+	onDeleteCascade  = "cascade"
+	onDeleteRestrict = "restrict"
+)
+
+// kbRef declara que el argumento Arg de Pred es el id (primer argumento) de
+// un hecho de Target. OnDelete indica qué pasa con Pred cuando ese id
+// desaparece de Target.
+type kbRef struct {
+	Pred     string
+	Arg      int
+	Target   string
+	OnDelete string
+}
+
+func (r kbRef) name() string { return r.Pred + "." + r.Target }
+
+var kbRefs = []kbRef{
+	{Pred: predDisSym, Arg: 0, Target: predDiseases, OnDelete: onDeleteCascade},
+	{Pred: predDisSym, Arg: 1, Target: predSymptoms, OnDelete: onDeleteRestrict},
+	{Pred: predContra, Arg: 0, Target: predMeds, OnDelete: onDeleteCascade},
+	{Pred: predContra, Arg: 1, Target: predChronics, OnDelete: onDeleteRestrict},
+	{Pred: predTrata, Arg: 0, Target: predDiseases, OnDelete: onDeleteCascade},
+	{Pred: predTrata, Arg: 1, Target: predMeds, OnDelete: onDeleteRestrict},
+	{Pred: predTreatPrio, Arg: 0, Target: predDiseases, OnDelete: onDeleteCascade},
+	{Pred: predTreatPrio, Arg: 1, Target: predMeds, OnDelete: onDeleteCascade},
+	{Pred: predInteraction, Arg: 0, Target: predMeds, OnDelete: onDeleteCascade},
+	{Pred: predInteraction, Arg: 1, Target: predMeds, OnDelete: onDeleteCascade},
+	{Pred: predDose, Arg: 0, Target: predMeds, OnDelete: onDeleteCascade},
+	{Pred: predRenalAdj, Arg: 0, Target: predMeds, OnDelete: onDeleteCascade},
+	{Pred: predModifier, Arg: 0, Target: predDiseases, OnDelete: onDeleteCascade},
+	{Pred: predPrior, Arg: 0, Target: predDiseases, OnDelete: onDeleteCascade},
+	{Pred: predSensitivity, Arg: 0, Target: predDiseases, OnDelete: onDeleteCascade},
+	{Pred: predSensitivity, Arg: 1, Target: predSymptoms, OnDelete: onDeleteRestrict},
+	{Pred: predPenalty, Arg: 0, Target: predDiseases, OnDelete: onDeleteCascade},
+	{Pred: predPenalty, Arg: 1, Target: predSymptoms, OnDelete: onDeleteRestrict},
+	{Pred: predDuration, Arg: 0, Target: predDiseases, OnDelete: onDeleteCascade},
+	{Pred: predDuration, Arg: 1, Target: predSymptoms, OnDelete: onDeleteRestrict},
+	{Pred: predOnset, Arg: 0, Target: predDiseases, OnDelete: onDeleteCascade},
+	{Pred: predOnset, Arg: 1, Target: predSymptoms, OnDelete: onDeleteRestrict},
+	{Pred: predRedFlagSym, Arg: 0, Target: predRedFlag, OnDelete: onDeleteCascade},
+	{Pred: predRedFlagSym, Arg: 1, Target: predSymptoms, OnDelete: onDeleteRestrict},
+	{Pred: predUrgencyBase, Arg: 0, Target: predDiseases, OnDelete: onDeleteCascade},
+	{Pred: predEscalation, Arg: 0, Target: predDiseases, OnDelete: onDeleteCascade},
+	{Pred: predEscalation, Arg: 1, Target: predSymptoms, OnDelete: onDeleteRestrict},
+	{Pred: predRedFlag, Arg: 2, Target: predSeverity, OnDelete: onDeleteRestrict},
+	{Pred: predEscalation, Arg: 2, Target: predSeverity, OnDelete: onDeleteRestrict},
+}
+
+// KBRefError se devuelve cuando una transacción deja referencias colgantes
+// (Missing) o borra algo que una relación en modo restrict sigue usando
+// (Dependents).
+type KBRefError struct {
+	Missing    []string
+	Dependents []string
+}
+
+func (e *KBRefError) Error() string {
+	if len(e.Missing) > 0 {
+		return "referencias inexistentes: " + strings.Join(e.Missing, ", ")
+	}
+	return "hay hechos que dependen de lo que se quiere borrar: " + strings.Join(e.Dependents, ", ")
+}
+
+// InitIntegrity aplica KB_ON_DELETE, una lista "relación=política" separada
+// por comas, p. ej. "enfermedad_sintoma.sintoma=cascade".
+func InitIntegrity() error {
+	spec := strings.TrimSpace(os.Getenv("KB_ON_DELETE"))
+	if spec == "" {
+		return nil
+	}
+	for _, item := range strings.Split(spec, ",") {
+		name, policy, ok := strings.Cut(strings.TrimSpace(item), "=")
+		policy = strings.ToLower(strings.TrimSpace(policy))
+		if !ok || (policy != onDeleteCascade && policy != onDeleteRestrict) {
+			return fmt.Errorf("KB_ON_DELETE: entrada inválida %q", item)
+		}
+		found := false
+		for i := range kbRefs {
+			if kbRefs[i].name() == strings.TrimSpace(name) {
+				kbRefs[i].OnDelete = policy
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("KB_ON_DELETE: relación desconocida %q", name)
+		}
+	}
+	return nil
+}
+
+func (tx *KBTx) ids(pred string) map[string]bool {
+	out := map[string]bool{}
+	for _, f := range tx.Facts(pred) {
+		out[f.Args[0]] = true
+	}
+	return out
+}
+
+// idTaken dice si pred es destino de alguna referencia y otro hecho de set
+// (distinto de la clave except) ya usa id como primer argumento. Los ids de
+// esos predicados tienen que ser únicos: si no, renombrar uno fusionaría dos
+// entidades y sus dependientes.
+func idTaken(pred string, set map[string]Fact, id, except string) bool {
+	if !slices.ContainsFunc(kbRefs, func(r kbRef) bool { return r.Target == pred }) {
+		return false
+	}
+	for k, f := range set {
+		if k != except && f.Args[0] == id {
+			return true
+		}
+	}
+	return false
+}
+
+// propagateRename cambia oldID por newID en los hechos que apuntan a target.
+// Se hace en el momento del Update y no al confirmar, así lo que el handler
+// haga después con los dependientes (p. ej. reemplazar los síntomas de una
+// enfermedad renombrada) ya los ve con el id nuevo. Si el hecho renombrado ya
+// existe, el Update falla con errKBExists y la transacción se descarta.
+func (tx *KBTx) propagateRename(target, oldID, newID string) error {
+	for _, ref := range kbRefs {
+		if ref.Target != target {
+			continue
+		}
+		for _, f := range tx.Facts(ref.Pred) {
+			if f.Args[ref.Arg] != oldID {
+				continue
+			}
+			args := append([]string(nil), f.Args...)
+			args[ref.Arg] = newID
+			if _, err := tx.Update(ref.Pred, f.Args, args); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// enforceRefs completa la transacción antes de persistirla: aplica cascadas y
+// rechaza borrados restringidos o hechos nuevos que apunten a ids inexistentes.
+func (tx *KBTx) enforceRefs() error {
+	refErr := &KBRefError{}
+	for changed := true; changed; {
+		changed = false
+		for _, ref := range kbRefs {
+			if _, ok := kbSchemas[ref.Pred]; !ok {
+				continue
+			}
+			if _, ok := kbSchemas[ref.Target]; !ok {
+				continue
+			}
+			current := tx.ids(ref.Target)
+			before := map[string]bool{}
+			for _, f := range kbFacts[ref.Target] {
+				before[f.Args[0]] = true
+			}
+			for _, f := range tx.Facts(ref.Pred) {
+				id := f.Args[ref.Arg]
+				if current[id] || !before[id] {
+					continue
+				}
+				if ref.OnDelete == onDeleteCascade {
+					if _, err := tx.Retract(ref.Pred, f.Args...); err != nil {
+						return err
+					}
+					changed = true
+					continue
+				}
+				refErr.Dependents = append(refErr.Dependents, f.Key())
+			}
+		}
+		if len(refErr.Dependents) > 0 {
+			return refErr
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, ref := range kbRefs {
+		if _, ok := kbSchemas[ref.Target]; !ok {
+			continue
+		}
+		current := tx.ids(ref.Target)
+		for _, op := range tx.ops {
+			f := op.Fact
+			if !op.Assert || f.Pred != ref.Pred || !tx.Has(f.Pred, f.Args...) {
+				continue
+			}
+			id := f.Args[ref.Arg]
+			miss := ref.Target + ":" + id
+			if !current[id] && !seen[miss] {
+				seen[miss] = true
+				refErr.Missing = append(refErr.Missing, miss)
+			}
+		}
+	}
+	if len(refErr.Missing) > 0 {
+		return refErr
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func kbHas(pred string, args ...string) bool {
+	want := Fact{Pred: pred, Args: args}.Key()
+	for _, f := range KBList(pred) {
+		if f.Key() == want {
+			return true
+		}
+	}
+	return false
+}
+
+// TestIntegrity recorre cascadas, restricciones y renombres propagados sobre
+// la base semilla.
+func TestIntegrity(t *testing.T) {
+	tests := []struct {
+		name        string
+		fn          func(tx *KBTx) error
+		wantErr     error
+		wantMissing []string
+		wantDeps    bool
+		present     []Fact
+		absent      []Fact
+	}{
+		{
+			name: "borrar una enfermedad borra en cascada sus relaciones",
+			fn: func(tx *KBTx) error {
+				_, err := tx.Retract(predDiseases, "gripe", "gripe_comun")
+				return err
+			},
+			absent: []Fact{
+				{Pred: predTrata, Args: []string{"gripe", "paracetamol"}},
+				{Pred: predDisSym, Args: []string{"gripe", "fiebre", "0.3"}},
+			},
+			present: []Fact{{Pred: predTrata, Args: []string{"covid19", "paracetamol"}}},
+		},
+		{
+			name: "un síntoma en uso no se puede borrar",
+			fn: func(tx *KBTx) error {
+				_, err := tx.Retract(predSymptoms, "fiebre")
+				return err
+			},
+			wantDeps: true,
+			present: []Fact{
+				{Pred: predSymptoms, Args: []string{"fiebre"}},
+				{Pred: predDisSym, Args: []string{"gripe", "fiebre", "0.3"}},
+			},
+		},
+		{
+			name: "un hecho que apunta a un id inexistente se rechaza",
+			fn: func(tx *KBTx) error {
+				_, err := tx.Assert(predDisSym, "gripe", "inexistente", "0.5")
+				return err
+			},
+			wantMissing: []string{"sintoma:inexistente"},
+			absent:      []Fact{{Pred: predDisSym, Args: []string{"gripe", "inexistente", "0.5"}}},
+		},
+		{
+			name: "renombrar propaga el id nuevo a los dependientes",
+			fn: func(tx *KBTx) error {
+				_, err := tx.Update(predDiseases, []string{"covid19", "covid_19"}, []string{"covid", "covid_19"})
+				return err
+			},
+			present: []Fact{
+				{Pred: predTrata, Args: []string{"covid", "paracetamol"}},
+				{Pred: predDisSym, Args: []string{"covid", "fiebre", "0.3"}},
+			},
+			absent: []Fact{{Pred: predTrata, Args: []string{"covid19", "paracetamol"}}},
+		},
+		{
+			name: "renombrar a un id existente falla sin fusionar",
+			fn: func(tx *KBTx) error {
+				_, err := tx.Update(predDiseases, []string{"covid19", "covid_19"}, []string{"gripe", "covid_19"})
+				return err
+			},
+			wantErr: errKBExists,
+			present: []Fact{
+				{Pred: predDiseases, Args: []string{"covid19", "covid_19"}},
+				{Pred: predTrata, Args: []string{"covid19", "paracetamol"}},
+			},
+		},
+		{
+			name: "otro hecho con el mismo id es un conflicto",
+			fn: func(tx *KBTx) error {
+				_, err := tx.Assert(predDiseases, "gripe", "otra")
+				return err
+			},
+			wantErr: errKBExists,
+			absent:  []Fact{{Pred: predDiseases, Args: []string{"gripe", "otra"}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			freshKB(t)
+			err := KBApply(context.Background(), tt.fn)
+			var refErr *KBRefError
+			switch {
+			case tt.wantMissing != nil || tt.wantDeps:
+				if !errors.As(err, &refErr) {
+					t.Fatalf("error = %v, se esperaba KBRefError", err)
+				}
+				if tt.wantDeps != (len(refErr.Dependents) > 0) {
+					t.Errorf("dependientes = %v", refErr.Dependents)
+				}
+				if tt.wantMissing != nil && !slices.Equal(refErr.Missing, tt.wantMissing) {
+					t.Errorf("faltantes = %v, se esperaba %v", refErr.Missing, tt.wantMissing)
+				}
+			case !errors.Is(err, tt.wantErr):
+				t.Fatalf("error = %v, se esperaba %v", err, tt.wantErr)
+			}
+			for _, f := range tt.present {
+				if !kbHas(f.Pred, f.Args...) {
+					t.Errorf("falta %s", f.Key())
+				}
+			}
+			for _, f := range tt.absent {
+				if kbHas(f.Pred, f.Args...) {
+					t.Errorf("sobra %s", f.Key())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+const (
+	predInteraction  = "interaccion"
+	fileInteractions = "prolog.pl"
+)
+
+// interactionSeverities son las severidades aceptadas para interaccion/3; las
+// que bloquean un medicamento se declaran con interaccion_bloquea/1 en
+// prolog.pl, el resto solo genera una advertencia.
+var interactionSeverities = map[string]bool{"leve": true, "moderada": true, "grave": true}
+
+type InteractionIn struct {
+	MedicationA string `json:"medicationA"`
+	MedicationB string `json:"medicationB"`
+	Severity    string `json:"severity"`
+}
+
+type InteractionOut struct {
+	MedicationA string `json:"medicationA"`
+	MedicationB string `json:"medicationB"`
+	Severity    string `json:"severity"`
+}
+
+func InitInteractions() error {
+	return KBRegister(PredSchema{Name: predInteraction, Types: []ArgType{ArgAtom, ArgAtom, ArgAtom}}, fileInteractions)
+}
+
+// interactionPair ordena el par para que interaccion(a,b,_) e
+// interaccion(b,a,_) sean el mismo hecho; la regla interactua/3 es simétrica.
+func interactionPair(a, b string) (string, string) {
+	a, b = toAtom(a), toAtom(b)
+	if b < a {
+		return b, a
+	}
+	return a, b
+}
+
+func findInteraction(tx *KBTx, a, b string) (Fact, bool) {
+	a, b = interactionPair(a, b)
+	for _, f := range tx.Facts(predInteraction) {
+		if f.Args[0] == a && f.Args[1] == b {
+			return f, true
+		}
+	}
+	return Fact{}, false
+}
+
+func validInteraction(w http.ResponseWriter, in InteractionIn) bool {
+	if strings.TrimSpace(in.MedicationA) == "" || strings.TrimSpace(in.MedicationB) == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(apiError{Error: "medicationA y medicationB son obligatorios"})
+		return false
+	}
+	if toAtom(in.MedicationA) == toAtom(in.MedicationB) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(apiError{Error: "un medicamento no interactúa consigo mismo"})
+		return false
+	}
+	if !interactionSeverities[toAtom(in.Severity)] {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(apiError{Error: "severity debe ser leve, moderada o grave"})
+		return false
+	}
+	return true
+}
+
+func interactionOut(f Fact) InteractionOut {
+	return InteractionOut{MedicationA: f.Args[0], MedicationB: f.Args[1], Severity: f.Args[2]}
+}
+
+func ListInteractions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(apiError{Error: "método no permitido"})
+		return
+	}
+	med := r.URL.Query().Get("medication")
+	out := []InteractionOut{}
+	for _, f := range KBList(predInteraction) {
+		if med != "" && f.Args[0] != toAtom(med) && f.Args[1] != toAtom(med) {
+			continue
+		}
+		out = append(out, interactionOut(f))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+func CreateInteraction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(apiError{Error: "método no permitido"})
+		return
+	}
+	var in InteractionIn
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(apiError{Error: "JSON inválido"})
+		return
+	}
+	if !validInteraction(w, in) {
+		return
+	}
+	var out InteractionOut
+	err := KBApply(r.Context(), func(tx *KBTx) error {
+		if _, found := findInteraction(tx, in.MedicationA, in.MedicationB); found {
+			return errKBExists
+		}
+		a, b := interactionPair(in.MedicationA, in.MedicationB)
+		f, err := tx.Assert(predInteraction, a, b, in.Severity)
+		out = interactionOut(f)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, errKBExists) {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(apiError{Error: "la interacción ya existe"})
+			return
+		}
+		writeKBError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(out)
+}
+
+func interactionPathIDs(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) != 4 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(apiError{Error: "ruta: /api/interactions/{medicationA}/{medicationB}"})
+		return "", "", false
+	}
+	return parts[2], parts[3], true
+}
+
+func UpdateInteraction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut && r.Method != http.MethodPatch {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(apiError{Error: "método no permitido"})
+		return
+	}
+	a, b, ok := interactionPathIDs(w, r)
+	if !ok {
+		return
+	}
+	var in InteractionIn
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(apiError{Error: "JSON inválido"})
+		return
+	}
+	if strings.TrimSpace(in.MedicationA) == "" {
+		in.MedicationA = a
+	}
+	if strings.TrimSpace(in.MedicationB) == "" {
+		in.MedicationB = b
+	}
+	keepSeverity := strings.TrimSpace(in.Severity) == ""
+	if keepSeverity {
+		in.Severity = "leve"
+	}
+	if !validInteraction(w, in) {
+		return
+	}
+	var out InteractionOut
+	err := KBApply(r.Context(), func(tx *KBTx) error {
+		cur, found := findInteraction(tx, a, b)
+		if !found {
+			return errKBNotFound
+		}
+		if keepSeverity {
+			in.Severity = cur.Args[2]
+		}
+		if _, err := tx.Retract(predInteraction, cur.Args...); err != nil {
+			return err
+		}
+		if _, found := findInteraction(tx, in.MedicationA, in.MedicationB); found {
+			return errKBExists
+		}
+		na, nb := interactionPair(in.MedicationA, in.MedicationB)
+		f, err := tx.Assert(predInteraction, na, nb, in.Severity)
+		out = interactionOut(f)
+		return err
+	})
+	if err != nil {
+		switch kbWhy(err) {
+		case "not_found":
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(apiError{Error: "no existe la interacción a actualizar"})
+		case "conflict":
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(apiError{Error: "ya existe esa interacción"})
+		default:
+			writeKBError(w, err)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+func DeleteInteraction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(apiError{Error: "método no permitido"})
+		return
+	}
+	a, b, ok := interactionPathIDs(w, r)
+	if !ok {
+		return
+	}
+	err := KBApply(r.Context(), func(tx *KBTx) error {
+		cur, found := findInteraction(tx, a, b)
+		if !found {
+			return errKBNotFound
+		}
+		_, err := tx.Retract(predInteraction, cur.Args...)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, errKBNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(apiError{Error: "no existe la interacción"})
+			return
+		}
+		writeKBError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
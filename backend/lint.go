@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	lintError   = "error"
+	lintWarning = "warning"
+	lintInfo    = "info"
+)
+
+type LintFinding struct {
+	Severity string `json:"severity"`
+	Code     string `json:"code"`
+	Subject  string `json:"subject"`
+	Message  string `json:"message"`
+}
+
+type LintReport struct {
+	Source   string         `json:"source"`
+	Summary  map[string]int `json:"summary"`
+	Findings []LintFinding  `json:"findings"`
+}
+
+// snapshotStore lo implementan los almacenes que pueden entregar su contenido
+// como un documento Prolog, con el texto original de cada hecho.
+type snapshotStore interface {
+	Snapshot() *plDoc
+}
+
+func (s *plFileStore) Snapshot() *plDoc {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return &plDoc{Clauses: append([]plClause(nil), s.doc.Clauses...), Tail: s.doc.Tail}
+}
+
+func (s *memStore) Snapshot() *plDoc {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return tableDoc(s.table, s.seed)
+}
+
+func (s *jsonStore) Snapshot() *plDoc {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return tableDoc(s.table, s.seed)
+}
+
+// tableDoc arma un documento con los hechos de la tabla y las reglas del .pl.
+func tableDoc(t factTable, seed *plDoc) *plDoc {
+	d := &plDoc{}
+	keys := make([]string, 0, len(t))
+	for k := range t {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		pred := k[:strings.LastIndex(k, "/")]
+		for _, args := range t[k] {
+			d.Clauses = append(d.Clauses, plNewClause("\n", Fact{Pred: pred, Args: args}.Clause()))
+		}
+	}
+	for _, c := range seed.Clauses {
+		if !c.Fact {
+			d.Clauses = append(d.Clauses, c)
+		}
+	}
+	return d
+}
+
+// plIsPlainAtom descarta números, variables, listas y términos compuestos,
+// que no pasan por toAtom.
+func plIsPlainAtom(a string) bool {
+	if _, isNum := normalizeNumber(a); isNum || a == "" {
+		return false
+	}
+	if a[0] == '\'' || a[0] == '"' {
+		return true
+	}
+	return !strings.ContainsAny(a[:1], "_[{ABCDEFGHIJKLMNOPQRSTUVWXYZ") && !strings.ContainsAny(a, "([{")
+}
+
+// lintDoc revisa la consistencia del catálogo médico de un documento.
+func lintDoc(source string, d *plDoc) LintReport {
+	var findings []LintFinding
+	add := func(sev, code, subject, msg string) {
+		findings = append(findings, LintFinding{Severity: sev, Code: code, Subject: subject, Message: msg})
+	}
+
+	facts := map[string][][]string{} // predicado -> argumentos normalizados
+	seenKey := map[string]bool{}
+	spellings := map[string]map[string]bool{} // átomo -> escrituras originales
+	for _, c := range d.Clauses {
+		if !c.Fact || c.Arity == 0 {
+			continue
+		}
+		args := make([]string, c.Arity)
+		for i, a := range c.Args {
+			args[i] = plNormArg(a)
+			if plIsPlainAtom(a) {
+				if spellings[args[i]] == nil {
+					spellings[args[i]] = map[string]bool{}
+				}
+				spellings[args[i]][trimQuotes(a)] = true
+			}
+		}
+		facts[c.Pred] = append(facts[c.Pred], args)
+		if seenKey[c.key()] {
+			add(lintWarning, "hecho_duplicado", c.key(), "el hecho aparece más de una vez")
+		}
+		seenKey[c.key()] = true
+	}
+
+	for _, atom := range sortedKeys(spellings) {
+		if len(spellings[atom]) > 1 {
+			add(lintError, "colision_atomo", atom,
+				"varias escrituras se normalizan al mismo átomo: "+strings.Join(sortedKeys(spellings[atom]), ", "))
+		}
+	}
+
+	ids := func(pred string) map[string]bool {
+		out := map[string]bool{}
+		for _, args := range facts[pred] {
+			out[args[0]] = true
+		}
+		return out
+	}
+	diseases := ids(predDiseases)
+	meds := ids(predMeds)
+	treated := ids(predTrata)
+
+	sums := map[string]float64{}
+	used := map[string]bool{}
+	for _, args := range facts[predDisSym] {
+		w, _ := strconv.ParseFloat(args[2], 64)
+		sums[args[0]] += w
+		used[args[1]] = true
+	}
+	for _, e := range sortedKeys(diseases) {
+		switch total := sums[e]; {
+		case total == 0:
+			add(lintWarning, "enfermedad_sin_sintomas", e, "la enfermedad no tiene hechos enfermedad_sintoma/3")
+		case math.Abs(total-1) > 1e-6:
+			add(lintWarning, "pesos_no_suman_1", e, "los pesos de enfermedad_sintoma/3 suman "+strconv.FormatFloat(round2dx(total), 'g', -1, 64))
+		}
+		if !treated[e] {
+			add(lintWarning, "enfermedad_sin_tratamiento", e, "no hay ningún hecho trata/2 para la enfermedad")
+		}
+	}
+
+	missingMed := map[string]bool{}
+	for _, args := range facts[predTrata] {
+		if !meds[args[1]] && !missingMed[args[1]] {
+			missingMed[args[1]] = true
+			add(lintError, "medicamento_inexistente", args[1], "trata/2 usa un medicamento que no está en medicamento/2")
+		}
+	}
+
+	for _, s := range sortedKeys(ids(predSymptoms)) {
+		if !used[s] {
+			add(lintInfo, "sintoma_sin_uso", s, "ninguna enfermedad usa el síntoma")
+		}
+	}
+
+	for _, ref := range kbRefs {
+		target := ids(ref.Target)
+		reported := map[string]bool{}
+		for _, args := range facts[ref.Pred] {
+			if ref.Arg >= len(args) {
+				continue
+			}
+			id := args[ref.Arg]
+			if !target[id] && !reported[id] {
+				reported[id] = true
+				add(lintError, "referencia_inexistente", ref.Target+":"+id, ref.Pred+" referencia un id que no está en "+ref.Target)
+			}
+		}
+	}
+
+	sevRank := map[string]int{lintError: 0, lintWarning: 1, lintInfo: 2}
+	sort.SliceStable(findings, func(i, j int) bool { return sevRank[findings[i].Severity] < sevRank[findings[j].Severity] })
+	summary := map[string]int{lintError: 0, lintWarning: 0, lintInfo: 0}
+	for _, f := range findings {
+		summary[f.Severity]++
+	}
+	if findings == nil {
+		findings = []LintFinding{}
+	}
+	return LintReport{Source: source, Summary: summary, Findings: findings}
+}
+
+func handleKBLint(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(apiError{Error: "método no permitido"})
+		return
+	}
+	plMutex.Lock()
+	files := sortedKeys(kbOpened)
+	merged := &plDoc{}
+	for _, file := range files {
+		if st, ok := kbOpened[file].(snapshotStore); ok {
+			merged.Clauses = append(merged.Clauses, st.Snapshot().Clauses...)
+		}
+	}
+	plMutex.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(lintDoc(strings.Join(files, ","), merged))
+}
+
+// runLintCLI implementa "backend lint archivo.pl". Devuelve el código de
+// salida: 1 si hay hallazgos de severidad error.
+func runLintCLI(args []string, stdout io.Writer) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "uso: backend lint archivo.pl")
+		return 2
+	}
+	d, err := plReadDoc(args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	rep := lintDoc(args[0], d)
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(rep)
+	if rep.Summary[lintError] > 0 {
+		return 1
+	}
+	return 0
+}
@@ -3,13 +3,36 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"os"
+	"strings"
 )
 
+// corsOrigins lee CORS_ORIGINS, una lista separada por comas; por omisión
+// solo el servidor de desarrollo de Vite.
+func corsOrigins() map[string]bool {
+	spec := os.Getenv("CORS_ORIGINS")
+	if strings.TrimSpace(spec) == "" {
+		spec = "http://localhost:5173"
+	}
+	out := map[string]bool{}
+	for _, o := range strings.Split(spec, ",") {
+		if o = strings.TrimRight(strings.TrimSpace(o), "/"); o != "" {
+			out[o] = true
+		}
+	}
+	return out
+}
+
+var allowedOrigins = corsOrigins()
+
 func withCORS(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Add("Vary", "Origin")
+		if origin := r.Header.Get("Origin"); allowedOrigins[origin] {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusOK)
 			return
@@ -18,91 +41,230 @@ func withCORS(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// initBackend registra los predicados y abre los almacenes. El orden
+// importa: integridad y versiones necesitan todos los predicados ya
+// registrados. Lo usan main y las pruebas.
+func initBackend() error {
+	for _, fn := range []func() error{
+		InitSymptoms,
+		InitDiseases,
+		InitMedications,
+		InitChronics,
+		InitAllergies,
+		InitTreatments,
+		InitInteractions,
+		InitDosing,
+		InitModifiers,
+		InitBayes,
+		InitPenalties,
+		InitTiming,
+		InitRedFlags,
+		InitUrgency,
+		InitSeverities,
+		InitIntegrity,
+		InitVersions,
+		InitRecords,
+		InitAuth,
+	} {
+		if err := fn(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func main() {
-	if err := InitSymptoms(); err != nil { panic(err) }
-	if err := InitDiseases(); err != nil { panic(err) }
-	if err := InitMedications(); err != nil { panic(err) }
-	if err := InitChronics(); err != nil { panic(err) }
-	if err := InitAllergies(); err != nil { panic(err) }
+	if len(os.Args) > 1 && os.Args[1] == "lint" {
+		os.Exit(runLintCLI(os.Args[2:], os.Stdout))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "bootstrap-admin" {
+		os.Exit(runBootstrapAdminCLI(os.Args[2:], os.Stdin, os.Stdout))
+	}
+
+	if err := initBackend(); err != nil { panic(err) }
 
-	http.HandleFunc("/api/symptoms", withCORS(func(w http.ResponseWriter, r *http.Request) {
+	http.HandleFunc("/api/symptoms", withCORS(withRoles(roleAnonymous, roleCurator, func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:  listSymptoms(w,r)
 		case http.MethodPost: createSymptom(w,r)
 		default: http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
 		}
-	}))
-	http.HandleFunc("/api/symptoms/", withCORS(func(w http.ResponseWriter, r *http.Request) {
+	})))
+	http.HandleFunc("/api/symptoms/", withCORS(withRoles(roleAnonymous, roleCurator, func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodDelete: deleteSymptom(w,r)
 		case http.MethodPut, http.MethodPatch: updateSymptom(w,r)
 		default: http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
 		}
-	}))
+	})))
 
-	http.HandleFunc("/api/diseases", withCORS(func(w http.ResponseWriter, r *http.Request) {
+	http.HandleFunc("/api/diseases", withCORS(withRoles(roleAnonymous, roleCurator, func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:  ListDiseases(w,r)
 		case http.MethodPost: CreateDisease(w,r)
 		default: http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
 		}
-	}))
-	http.HandleFunc("/api/diseases/", withCORS(func(w http.ResponseWriter, r *http.Request) {
+	})))
+	http.HandleFunc("/api/diseases/", withCORS(withRoles(roleAnonymous, roleCurator, func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodDelete: DeleteDisease(w,r)
 		case http.MethodPut, http.MethodPatch: UpdateDisease(w,r)
 		default: http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
 		}
-	}))
+	})))
 
-	http.HandleFunc("/api/medications", withCORS(func(w http.ResponseWriter, r *http.Request) {
+	http.HandleFunc("/api/medications", withCORS(withRoles(roleAnonymous, roleCurator, func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:  ListMedications(w,r)
 		case http.MethodPost: CreateMedication(w,r)
 		default: http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
 		}
-	}))
-	http.HandleFunc("/api/medications/", withCORS(func(w http.ResponseWriter, r *http.Request) {
+	})))
+	http.HandleFunc("/api/medications/", withCORS(withRoles(roleAnonymous, roleCurator, func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodDelete: DeleteMedication(w,r)
 		case http.MethodPut, http.MethodPatch: UpdateMedication(w,r)
 		default: http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
 		}
-	}))
+	})))
 
-	http.HandleFunc("/api/chronics", withCORS(func(w http.ResponseWriter, r *http.Request) {
+	http.HandleFunc("/api/chronics", withCORS(withRoles(roleAnonymous, roleCurator, func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:  ListChronics(w,r)
 		case http.MethodPost: CreateChronic(w,r)
 		default: http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
 		}
-	}))
-	http.HandleFunc("/api/chronics/", withCORS(func(w http.ResponseWriter, r *http.Request) {
+	})))
+	http.HandleFunc("/api/chronics/", withCORS(withRoles(roleAnonymous, roleCurator, func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodDelete: DeleteChronic(w,r)
 		case http.MethodPut, http.MethodPatch: UpdateChronic(w,r)
 		default: http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
 		}
-	}))
+	})))
 
-	http.HandleFunc("/api/allergies", withCORS(func(w http.ResponseWriter, r *http.Request) {
+	http.HandleFunc("/api/allergies", withCORS(withRoles(roleAnonymous, roleCurator, func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:  ListAllergies(w,r)
 		case http.MethodPost: CreateAllergy(w,r)
 		default: http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
 		}
-	}))
-	http.HandleFunc("/api/allergies/", withCORS(func(w http.ResponseWriter, r *http.Request) {
+	})))
+	http.HandleFunc("/api/allergies/", withCORS(withRoles(roleAnonymous, roleCurator, func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodDelete: DeleteAllergy(w,r)
 		case http.MethodPut, http.MethodPatch: UpdateAllergy(w,r)
 		default: http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
 		}
-	}))
+	})))
+
+	http.HandleFunc("/api/treatments", withCORS(withRoles(roleAnonymous, roleCurator, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:  ListTreatments(w,r)
+		case http.MethodPost: CreateTreatment(w,r)
+		default: http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		}
+	})))
+	http.HandleFunc("/api/treatments/", withCORS(withRoles(roleAnonymous, roleCurator, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodDelete: DeleteTreatment(w,r)
+		case http.MethodPut, http.MethodPatch: UpdateTreatment(w,r)
+		default: http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		}
+	})))
 
-	http.HandleFunc("/api/diagnosis", withCORS(handleDiagnosis))
+	http.HandleFunc("/api/interactions", withCORS(withRoles(roleAnonymous, roleCurator, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:  ListInteractions(w,r)
+		case http.MethodPost: CreateInteraction(w,r)
+		default: http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		}
+	})))
+	http.HandleFunc("/api/interactions/", withCORS(withRoles(roleAnonymous, roleCurator, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodDelete: DeleteInteraction(w,r)
+		case http.MethodPut, http.MethodPatch: UpdateInteraction(w,r)
+		default: http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		}
+	})))
 
-	http.HandleFunc("/api/diagnosis/pdf", withCORS(handleDiagnosisPDF))
+	http.HandleFunc("/api/modifiers", withCORS(withRoles(roleAnonymous, roleCurator, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:  ListModifiers(w,r)
+		case http.MethodPost: CreateModifier(w,r)
+		default: http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		}
+	})))
+	http.HandleFunc("/api/modifiers/", withCORS(withRoles(roleAnonymous, roleCurator, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodDelete: DeleteModifier(w,r)
+		case http.MethodPut, http.MethodPatch: UpdateModifier(w,r)
+		default: http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		}
+	})))
+
+	http.HandleFunc("/api/redflags", withCORS(withRoles(roleAnonymous, roleCurator, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:  ListRedFlags(w,r)
+		case http.MethodPost: CreateRedFlag(w,r)
+		default: http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		}
+	})))
+	http.HandleFunc("/api/redflags/", withCORS(withRoles(roleAnonymous, roleCurator, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodDelete: DeleteRedFlag(w,r)
+		case http.MethodPut, http.MethodPatch: UpdateRedFlag(w,r)
+		default: http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		}
+	})))
+
+	http.HandleFunc("/api/severities", withCORS(withRoles(roleAnonymous, roleCurator, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:  ListSeverities(w,r)
+		case http.MethodPost: CreateSeverity(w,r)
+		default: http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		}
+	})))
+	http.HandleFunc("/api/severities/", withCORS(withRoles(roleAnonymous, roleCurator, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodDelete: DeleteSeverity(w,r)
+		case http.MethodPut, http.MethodPatch: UpdateSeverity(w,r)
+		default: http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		}
+	})))
+
+	http.HandleFunc("/api/patients", withCORS(withRoles(roleClinician, roleClinician, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:  ListPatients(w,r)
+		case http.MethodPost: CreatePatient(w,r)
+		default: http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		}
+	})))
+	http.HandleFunc("/api/patients/", withCORS(withRoles(roleClinician, roleClinician, handlePatient)))
+	http.HandleFunc("/api/diagnoses", withCORS(withRoles(roleClinician, roleClinician, ListDiagnoses)))
+	http.HandleFunc("/api/diagnoses/", withCORS(withRoles(roleClinician, roleClinician, handleDiagnosisRecord)))
+
+	http.HandleFunc("/api/audit", withCORS(withRoles(roleCurator, roleCurator, ListAudit)))
+
+	http.HandleFunc("/api/kb/versions", withCORS(withRoles(roleReadOnly, roleCurator, ListVersions)))
+	http.HandleFunc("/api/kb/versions/", withCORS(withRoles(roleReadOnly, roleCurator, handleVersion)))
+	http.HandleFunc("/api/kb/lint", withCORS(withRoles(roleReadOnly, roleReadOnly, handleKBLint)))
+
+	http.HandleFunc("/api/diagnosis", withCORS(withRoles(roleAnonymous, roleAnonymous, handleDiagnosis)))
+
+	http.HandleFunc("/api/diagnosis/pdf", withCORS(withRoles(roleAnonymous, roleAnonymous, handleDiagnosisPDF)))
+
+	http.HandleFunc("/api/auth/login", withCORS(handleLogin))
+	http.HandleFunc("/api/auth/logout", withCORS(handleLogout))
+	http.HandleFunc("/api/auth/me", withCORS(withRoles(roleReadOnly, roleReadOnly, handleMe)))
+	http.HandleFunc("/api/users", withCORS(withRoles(roleAdmin, roleAdmin, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:  ListUsers(w,r)
+		case http.MethodPost: CreateUser(w,r)
+		default: http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		}
+	})))
+	http.HandleFunc("/api/users/", withCORS(withRoles(roleAdmin, roleAdmin, handleUser)))
 
 	fmt.Println("Servidor en http://localhost:8000")
 	http.ListenAndServe(":8000", nil)
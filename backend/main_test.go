@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+// TestMain levanta la base semilla (prolog.pl) en el almacén en memoria, con
+// DATA_DIR en un directorio temporal, así las pruebas no tocan archivos del
+// repositorio.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "backend-test-")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Setenv("KB_STORE", "memory")
+	os.Setenv("DATA_DIR", dir)
+	if err := initBackend(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.RemoveAll(dir)
+		os.Exit(1)
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// resetKB vuelve a cargar la base semilla desde cero, con almacenes nuevos.
+func resetKB() error {
+	kbWriteMu.Lock()
+	plMutex.Lock()
+	kbSchemas = map[string]PredSchema{}
+	kbFacts = map[string]map[string]Fact{}
+	kbStores = map[string]FactStore{}
+	kbOpened = map[string]FactStore{}
+	kbVersion = 0
+	plMutex.Unlock()
+	kbWriteMu.Unlock()
+	auditMu.Lock()
+	auditSeq = -1
+	auditMu.Unlock()
+	return initBackend()
+}
+
+// freshKB da a la prueba una base semilla propia, con su DATA_DIR, para que
+// lo que confirme no se vea en las demás pruebas. Al terminar se recarga la
+// base compartida.
+func freshKB(t *testing.T) {
+	t.Helper()
+	t.Cleanup(func() {
+		if err := resetKB(); err != nil {
+			t.Error(err)
+		}
+	})
+	t.Setenv("DATA_DIR", t.TempDir())
+	if err := resetKB(); err != nil {
+		t.Fatal(err)
+	}
+}
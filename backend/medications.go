@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strings"
 )
@@ -76,17 +77,30 @@ func CreateMedication(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(apiError{Error: "id y name son obligatorios"})
 		return
 	}
-	if _, ok := Create2(predMeds, in.ID, in.Name); !ok {
-		w.WriteHeader(http.StatusConflict)
-		json.NewEncoder(w).Encode(apiError{Error: "el medicamento ya existe"})
+	var out MedicationOut
+	err := KBApply(r.Context(), func(tx *KBTx) error {
+		m, err := tx.Assert(predMeds, in.ID, in.Name)
+		if err != nil {
+			return err
+		}
+		if err := addMedicationContra(tx, m.Args[0], in.Contraindications); err != nil {
+			return err
+		}
+		out = MedicationOut{ID: m.Args[0], Name: m.Args[1], Contraindications: readMedicationContra(tx.Facts(predContra), m.Args[0])}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, errKBExists) {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(apiError{Error: "el medicamento ya existe"})
+			return
+		}
+		writeKBError(w, err)
 		return
 	}
-	for _, ch := range in.Contraindications {
-		_, _ = Create2(predContra, in.ID, ch)
-	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(MedicationOut{ID: toAtom(in.ID), Name: toAtom(in.Name), Contraindications: in.Contraindications})
+	json.NewEncoder(w).Encode(out)
 }
 
 func UpdateMedication(w http.ResponseWriter, r *http.Request) {
@@ -113,9 +127,22 @@ func UpdateMedication(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(apiError{Error: "id y name son obligatorios"})
 		return
 	}
-	oldName := getMedicationName(oldID)
-	if _, ok, why := Update2(predMeds, oldID, oldName, in.ID, in.Name); !ok {
-		switch why {
+	var out MedicationOut
+	err := KBApply(r.Context(), func(tx *KBTx) error {
+		m, err := tx.Update(predMeds, []string{oldID, getMedicationName(tx, oldID)}, []string{in.ID, in.Name})
+		if err != nil {
+			return err
+		}
+		if in.Contraindications != nil {
+			if err := replaceMedicationContra(tx, m.Args[0], in.Contraindications); err != nil {
+				return err
+			}
+		}
+		out = MedicationOut{ID: m.Args[0], Name: m.Args[1]}
+		return nil
+	})
+	if err != nil {
+		switch kbWhy(err) {
 		case "not_found":
 			w.WriteHeader(http.StatusNotFound)
 			json.NewEncoder(w).Encode(apiError{Error: "no existe el medicamento a actualizar"})
@@ -123,19 +150,14 @@ func UpdateMedication(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusConflict)
 			json.NewEncoder(w).Encode(apiError{Error: "ya existe un medicamento con ese id/nombre"})
 		default:
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(apiError{Error: "error en actualización"})
+			writeKBError(w, err)
 		}
 		return
 	}
-	if toAtom(oldID) != toAtom(in.ID) {
-		renameContraForMedication(oldID, in.ID)
-	}
-	if in.Contraindications != nil {
-		replaceMedicationContra(in.ID, in.Contraindications)
-	}
+	// los renombres se propagan al confirmar, por eso se lee después
+	out.Contraindications = readMedicationContra(KBList(predContra), out.ID)
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(MedicationOut{ID: toAtom(in.ID), Name: toAtom(in.Name), Contraindications: readMedicationContra(in.ID)})
+	json.NewEncoder(w).Encode(out)
 }
 
 func DeleteMedication(w http.ResponseWriter, r *http.Request) {
@@ -151,62 +173,67 @@ func DeleteMedication(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	id := parts[2]
-	if !Delete2(predMeds, id, getMedicationName(id)) {
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(apiError{Error: "no existe el medicamento"})
+	err := KBApply(r.Context(), func(tx *KBTx) error {
+		_, err := tx.Retract(predMeds, id, getMedicationName(tx, id))
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, errKBNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(apiError{Error: "no existe el medicamento"})
+			return
+		}
+		writeKBError(w, err)
 		return
 	}
-	deleteAllMedicationContra(id)
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func getMedicationName(id string) string {
+func getMedicationName(tx *KBTx, id string) string {
 	id = toAtom(id)
-	for _, p := range List2(predMeds) {
-		if p[0] == id {
-			return p[1]
+	for _, f := range tx.Facts(predMeds) {
+		if f.Args[0] == id {
+			return f.Args[1]
 		}
 	}
 	return ""
 }
 
-func readMedicationContra(medID string) []string {
+func readMedicationContra(contras []Fact, medID string) []string {
 	medID = toAtom(medID)
 	var out []string
-	for _, c := range List2(predContra) {
-		if c[0] == medID {
-			out = append(out, c[1])
+	for _, f := range contras {
+		if f.Args[0] == medID {
+			out = append(out, f.Args[1])
 		}
 	}
 	return out
 }
 
-func deleteAllMedicationContra(medID string) {
-	medID = toAtom(medID)
-	for _, c := range List2(predContra) {
-		if c[0] == medID {
-			_ = Delete2(predContra, c[0], c[1])
+func addMedicationContra(tx *KBTx, medID string, list []string) error {
+	for _, ch := range list {
+		if _, err := tx.Assert(predContra, medID, ch); err != nil && !errors.Is(err, errKBExists) {
+			return err
 		}
 	}
+	return nil
 }
 
-func replaceMedicationContra(medID string, list []string) {
+func deleteAllMedicationContra(tx *KBTx, medID string) error {
 	medID = toAtom(medID)
-	deleteAllMedicationContra(medID)
-	for _, ch := range list {
-		_, _ = Create2(predContra, medID, ch)
+	for _, f := range tx.Facts(predContra) {
+		if f.Args[0] == medID {
+			if _, err := tx.Retract(predContra, f.Args...); err != nil {
+				return err
+			}
+		}
 	}
+	return nil
 }
 
-func renameContraForMedication(oldID, newID string) {
-	oldID = toAtom(oldID)
-	newID = toAtom(newID)
-	for _, c := range List2(predContra) {
-		if c[0] == oldID {
-			_, ok, _ := Update2(predContra, c[0], c[1], newID, c[1])
-			if !ok {
-				_ = Delete2(predContra, c[0], c[1])
-			}
-		}
+func replaceMedicationContra(tx *KBTx, medID string, list []string) error {
+	if err := deleteAllMedicationContra(tx, medID); err != nil {
+		return err
 	}
+	return addMedicationContra(tx, toAtom(medID), list)
 }
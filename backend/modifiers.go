@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	predModifier  = "modificador"
+	fileModifiers = "prolog.pl"
+)
+
+// patientConditions son las condiciones que deriva condicion_paciente/2 en
+// prolog.pl a partir de los datos del paciente.
+var patientConditions = map[string]bool{
+	"fumador":            true,
+	"inmunocomprometido": true,
+	"viaje_reciente":     true,
+	"embarazo":           true,
+	"femenino":           true,
+	"masculino":          true,
+	"pediatrico":         true,
+	"adulto_mayor":       true,
+}
+
+type ModifierIn struct {
+	DiseaseID string   `json:"diseaseId"`
+	Condition string   `json:"condition"`
+	Factor    *float64 `json:"factor"`
+}
+
+type ModifierOut struct {
+	DiseaseID string  `json:"diseaseId"`
+	Condition string  `json:"condition"`
+	Factor    float64 `json:"factor"`
+}
+
+func InitModifiers() error {
+	return Register3(predModifier, fileModifiers)
+}
+
+func modifierOut(f Fact) ModifierOut {
+	v, _ := strconv.ParseFloat(f.Args[2], 64)
+	return ModifierOut{DiseaseID: f.Args[0], Condition: f.Args[1], Factor: v}
+}
+
+func findModifier(tx *KBTx, diseaseID, cond string) (Fact, bool) {
+	diseaseID, cond = toAtom(diseaseID), toAtom(cond)
+	for _, f := range tx.Facts(predModifier) {
+		if f.Args[0] == diseaseID && f.Args[1] == cond {
+			return f, true
+		}
+	}
+	return Fact{}, false
+}
+
+func validModifier(w http.ResponseWriter, in ModifierIn) bool {
+	if strings.TrimSpace(in.DiseaseID) == "" || strings.TrimSpace(in.Condition) == "" || in.Factor == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(apiError{Error: "diseaseId, condition y factor son obligatorios"})
+		return false
+	}
+	if !patientConditions[toAtom(in.Condition)] {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(apiError{Error: "condition debe ser una de: " + strings.Join(sortedKeys(patientConditions), ", ")})
+		return false
+	}
+	if *in.Factor <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(apiError{Error: "factor debe ser mayor que 0"})
+		return false
+	}
+	return true
+}
+
+func ListModifiers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(apiError{Error: "método no permitido"})
+		return
+	}
+	disease := r.URL.Query().Get("disease")
+	out := []ModifierOut{}
+	for _, f := range KBList(predModifier) {
+		if disease != "" && f.Args[0] != toAtom(disease) {
+			continue
+		}
+		out = append(out, modifierOut(f))
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].DiseaseID != out[j].DiseaseID {
+			return out[i].DiseaseID < out[j].DiseaseID
+		}
+		return out[i].Condition < out[j].Condition
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+func CreateModifier(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(apiError{Error: "método no permitido"})
+		return
+	}
+	var in ModifierIn
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(apiError{Error: "JSON inválido"})
+		return
+	}
+	if !validModifier(w, in) {
+		return
+	}
+	var out ModifierOut
+	err := KBApply(r.Context(), func(tx *KBTx) error {
+		if _, found := findModifier(tx, in.DiseaseID, in.Condition); found {
+			return errKBExists
+		}
+		f, err := tx.Assert(predModifier, in.DiseaseID, in.Condition, strconv.FormatFloat(*in.Factor, 'g', -1, 64))
+		out = modifierOut(f)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, errKBExists) {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(apiError{Error: "el modificador ya existe"})
+			return
+		}
+		writeKBError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(out)
+}
+
+func modifierPathIDs(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) != 4 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(apiError{Error: "ruta: /api/modifiers/{diseaseId}/{condition}"})
+		return "", "", false
+	}
+	return parts[2], parts[3], true
+}
+
+func UpdateModifier(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut && r.Method != http.MethodPatch {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(apiError{Error: "método no permitido"})
+		return
+	}
+	disease, cond, ok := modifierPathIDs(w, r)
+	if !ok {
+		return
+	}
+	var in ModifierIn
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(apiError{Error: "JSON inválido"})
+		return
+	}
+	if strings.TrimSpace(in.DiseaseID) == "" {
+		in.DiseaseID = disease
+	}
+	if strings.TrimSpace(in.Condition) == "" {
+		in.Condition = cond
+	}
+	if !validModifier(w, in) {
+		return
+	}
+	var out ModifierOut
+	err := KBApply(r.Context(), func(tx *KBTx) error {
+		cur, found := findModifier(tx, disease, cond)
+		if !found {
+			return errKBNotFound
+		}
+		if _, err := tx.Retract(predModifier, cur.Args...); err != nil {
+			return err
+		}
+		if _, found := findModifier(tx, in.DiseaseID, in.Condition); found {
+			return errKBExists
+		}
+		f, err := tx.Assert(predModifier, in.DiseaseID, in.Condition, strconv.FormatFloat(*in.Factor, 'g', -1, 64))
+		out = modifierOut(f)
+		return err
+	})
+	if err != nil {
+		switch kbWhy(err) {
+		case "not_found":
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(apiError{Error: "no existe el modificador a actualizar"})
+		case "conflict":
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(apiError{Error: "ya existe ese modificador"})
+		default:
+			writeKBError(w, err)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+func DeleteModifier(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(apiError{Error: "método no permitido"})
+		return
+	}
+	disease, cond, ok := modifierPathIDs(w, r)
+	if !ok {
+		return
+	}
+	err := KBApply(r.Context(), func(tx *KBTx) error {
+		cur, found := findModifier(tx, disease, cond)
+		if !found {
+			return errKBNotFound
+		}
+		_, err := tx.Retract(predModifier, cur.Args...)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, errKBNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(apiError{Error: "no existe el modificador"})
+			return
+		}
+		writeKBError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var errRecordNotFound = errors.New("registro inexistente")
+
+// recordStore guarda pacientes y diagnósticos como un archivo JSON por
+// registro: {dir}/patients/{id}.json y {dir}/diagnoses/{paciente}/{id}.json.
+// El directorio por paciente hace de índice: el historial de uno no lee los
+// de los demás. Son datos clínicos, no conocimiento, así que no pasan por la
+// base Prolog.
+type recordStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+// dataDir es DATA_DIR o, por defecto, ./data.
+func dataDir() string {
+	if dir := strings.TrimSpace(os.Getenv("DATA_DIR")); dir != "" {
+		return dir
+	}
+	return "data"
+}
+
+func openRecordStore() (*recordStore, error) {
+	dir := dataDir()
+	for _, sub := range []string{"patients", "diagnoses"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return nil, err
+		}
+	}
+	return &recordStore{dir: dir}, nil
+}
+
+func newRecordID(prefix string) string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return prefix + hex.EncodeToString(b)
+}
+
+// validRecordID evita que un id de la URL salga del directorio.
+func validRecordID(id string) bool {
+	return id != "" && !strings.ContainsAny(id, `/\.`)
+}
+
+func (s *recordStore) path(kind, id string) string {
+	return filepath.Join(s.dir, kind, id+".json")
+}
+
+func (s *recordStore) read(kind, id string, v any) error {
+	if !validRecordID(id) {
+		return errRecordNotFound
+	}
+	data, err := os.ReadFile(s.path(kind, id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return errRecordNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (s *recordStore) write(kind, id string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path(kind, id), data)
+}
+
+func (s *recordStore) remove(kind, id string) error {
+	err := os.Remove(s.path(kind, id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return errRecordNotFound
+	}
+	return err
+}
+
+// readAll decodifica todos los registros de un tipo.
+func readAll[T any](s *recordStore, kind string) ([]T, error) {
+	entries, err := os.ReadDir(filepath.Join(s.dir, kind))
+	if err != nil {
+		return nil, err
+	}
+	out := []T{}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".json") || strings.HasPrefix(name, ".") {
+			continue
+		}
+		var v T
+		if err := s.read(kind, strings.TrimSuffix(name, ".json"), &v); err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+func (s *recordStore) Patients() ([]Patient, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out, err := readAll[Patient](s, "patients")
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, err
+}
+
+func (s *recordStore) Patient(id string) (Patient, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var p Patient
+	err := s.read("patients", id, &p)
+	return p, err
+}
+
+// SavePatient crea o reemplaza; create=true falla con errKBExists si ya
+// existe y create=false con errRecordNotFound si no existe.
+func (s *recordStore) SavePatient(p Patient, create bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := os.Stat(s.path("patients", p.ID))
+	switch {
+	case create && err == nil:
+		return errKBExists
+	case !create && errors.Is(err, fs.ErrNotExist):
+		return errRecordNotFound
+	}
+	return s.write("patients", p.ID, p)
+}
+
+// DeletePatient borra al paciente y su historial.
+func (s *recordStore) DeletePatient(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !validRecordID(id) {
+		return errRecordNotFound
+	}
+	if err := s.remove("patients", id); err != nil {
+		return err
+	}
+	return os.RemoveAll(filepath.Join(s.dir, diagnosesKind(id)))
+}
+
+// diagnosesKind es el subdirectorio con el historial de un paciente.
+func diagnosesKind(patientID string) string {
+	return filepath.Join("diagnoses", patientID)
+}
+
+// SaveDiagnosis guarda una corrida en el historial de su paciente; sin
+// paciente no hay dónde guardarla.
+func (s *recordStore) SaveDiagnosis(r DiagnosisRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !validRecordID(r.PatientID) {
+		return errRecordNotFound
+	}
+	if err := os.MkdirAll(filepath.Join(s.dir, diagnosesKind(r.PatientID)), 0o755); err != nil {
+		return err
+	}
+	return s.write(diagnosesKind(r.PatientID), r.ID, r)
+}
+
+func (s *recordStore) Diagnosis(id string) (DiagnosisRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var r DiagnosisRecord
+	if !validRecordID(id) {
+		return r, errRecordNotFound
+	}
+	files, err := filepath.Glob(filepath.Join(s.dir, "diagnoses", "*", id+".json"))
+	if err != nil || len(files) == 0 {
+		return r, errRecordNotFound
+	}
+	err = s.read(diagnosesKind(filepath.Base(filepath.Dir(files[0]))), id, &r)
+	return r, err
+}
+
+// Diagnoses devuelve el historial del paciente ("" = todos), del más nuevo
+// al más viejo. Con paciente solo lee su directorio.
+func (s *recordStore) Diagnoses(patientID string) ([]DiagnosisRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	patients := []string{patientID}
+	if patientID == "" {
+		entries, err := os.ReadDir(filepath.Join(s.dir, "diagnoses"))
+		if err != nil {
+			return nil, err
+		}
+		patients = patients[:0]
+		for _, e := range entries {
+			if e.IsDir() {
+				patients = append(patients, e.Name())
+			}
+		}
+	}
+	out := []DiagnosisRecord{}
+	for _, id := range patients {
+		if !validRecordID(id) {
+			continue
+		}
+		recs, err := readAll[DiagnosisRecord](s, diagnosesKind(id))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, recs...)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].GeneratedAt != out[j].GeneratedAt {
+			return out[i].GeneratedAt > out[j].GeneratedAt
+		}
+		return out[i].ID > out[j].ID
+	})
+	return out, nil
+}
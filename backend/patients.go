@@ -0,0 +1,391 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Patient es la ficha del paciente. Alergias, crónicas y medicación actual
+// tienen que existir en alergia/1, cronica/1 y medicamento/2.
+type Patient struct {
+	ID                 string          `json:"id"`
+	Name               string          `json:"name"`
+	Demographics       *DxDemographics `json:"demographics,omitempty"`
+	Allergies          []string        `json:"allergies"`
+	Chronics           []string        `json:"chronics"`
+	CurrentMedications []string        `json:"currentMedications"`
+	CreatedAt          string          `json:"createdAt"`
+	UpdatedAt          string          `json:"updatedAt"`
+}
+
+// DiagnosisRecord es una corrida de diagnóstico guardada, con la entrada y
+// los resultados tal como se devolvieron.
+type DiagnosisRecord struct {
+	ID          string       `json:"id"`
+	PatientID   string       `json:"patientId,omitempty"`
+	GeneratedAt string       `json:"generatedAt"`
+	Output      DiagnosisOut `json:"output"`
+}
+
+var records *recordStore
+
+func InitRecords() error {
+	var err error
+	records, err = openRecordStore()
+	diagnosisService.Records = records
+	return err
+}
+
+// validPatient normaliza las listas y devuelve el mensaje de error o "".
+func validPatient(p *Patient) string {
+	if strings.TrimSpace(p.Name) == "" {
+		return "name es obligatorio"
+	}
+	if d := p.Demographics; d != nil {
+		for _, v := range []*float64{d.AgeYears, d.WeightKg, d.CreatinineClearance} {
+			if v != nil && *v < 0 {
+				return "los datos demográficos no pueden ser negativos"
+			}
+		}
+	}
+	meds := map[string]bool{}
+	for _, f := range KBList(predMeds) {
+		meds[f.Args[0]] = true
+	}
+	known := func(ids []string) map[string]bool {
+		out := map[string]bool{}
+		for _, id := range ids {
+			out[id] = true
+		}
+		return out
+	}
+	checks := []struct {
+		field string
+		list  *[]string
+		known map[string]bool
+	}{
+		{"allergies", &p.Allergies, known(PLList(predAllergies))},
+		{"chronics", &p.Chronics, known(PLList(predChronics))},
+		{"currentMedications", &p.CurrentMedications, meds},
+	}
+	for _, c := range checks {
+		norm := []string{}
+		var missing []string
+		for _, v := range *c.list {
+			a := toAtom(v)
+			if !c.known[a] {
+				missing = append(missing, a)
+			}
+			norm = append(norm, a)
+		}
+		if len(missing) > 0 {
+			return c.field + " no existe en la base: " + strings.Join(missing, ", ")
+		}
+		*c.list = norm
+	}
+	return ""
+}
+
+func writeRecordError(w http.ResponseWriter, err error, notFound string) {
+	if errors.Is(err, errRecordNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(apiError{Error: notFound})
+		return
+	}
+	w.WriteHeader(http.StatusInternalServerError)
+	json.NewEncoder(w).Encode(apiError{Error: err.Error()})
+}
+
+func ListPatients(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(apiError{Error: "método no permitido"})
+		return
+	}
+	out, err := records.Patients()
+	if err != nil {
+		writeRecordError(w, err, "")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+func CreatePatient(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(apiError{Error: "método no permitido"})
+		return
+	}
+	var p Patient
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(apiError{Error: "JSON inválido"})
+		return
+	}
+	if strings.TrimSpace(p.ID) == "" {
+		p.ID = newRecordID("p")
+	} else {
+		p.ID = toAtom(p.ID)
+	}
+	if !validRecordID(p.ID) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(apiError{Error: "id inválido"})
+		return
+	}
+	if msg := validPatient(&p); msg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(apiError{Error: msg})
+		return
+	}
+	p.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	p.UpdatedAt = p.CreatedAt
+	if err := records.SavePatient(p, true); err != nil {
+		if errors.Is(err, errKBExists) {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(apiError{Error: "el paciente ya existe"})
+			return
+		}
+		writeRecordError(w, err, "")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(p)
+}
+
+// handlePatient atiende /api/patients/{id} y /api/patients/{id}/diagnoses.
+func handlePatient(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(parts) == 4 && parts[3] == "diagnoses" && r.Method == http.MethodGet:
+		listPatientDiagnoses(w, parts[2])
+	case len(parts) != 3:
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(apiError{Error: "ruta: /api/patients/{id}[/diagnoses]"})
+	case r.Method == http.MethodGet:
+		getPatient(w, parts[2])
+	case r.Method == http.MethodPut || r.Method == http.MethodPatch:
+		updatePatient(w, r, parts[2])
+	case r.Method == http.MethodDelete:
+		if err := records.DeletePatient(parts[2]); err != nil {
+			writeRecordError(w, err, "no existe el paciente")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(apiError{Error: "método no permitido"})
+	}
+}
+
+func getPatient(w http.ResponseWriter, id string) {
+	p, err := records.Patient(id)
+	if err != nil {
+		writeRecordError(w, err, "no existe el paciente")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
+
+func updatePatient(w http.ResponseWriter, r *http.Request, id string) {
+	cur, err := records.Patient(id)
+	if err != nil {
+		writeRecordError(w, err, "no existe el paciente a actualizar")
+		return
+	}
+	var p Patient
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(apiError{Error: "JSON inválido"})
+		return
+	}
+	if strings.TrimSpace(p.ID) != "" && toAtom(p.ID) != cur.ID {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(apiError{Error: "el id del paciente no se puede cambiar"})
+		return
+	}
+	if msg := validPatient(&p); msg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(apiError{Error: msg})
+		return
+	}
+	p.ID, p.CreatedAt = cur.ID, cur.CreatedAt
+	p.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	if err := records.SavePatient(p, false); err != nil {
+		writeRecordError(w, err, "no existe el paciente a actualizar")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
+
+func listPatientDiagnoses(w http.ResponseWriter, id string) {
+	if _, err := records.Patient(id); err != nil {
+		writeRecordError(w, err, "no existe el paciente")
+		return
+	}
+	out, err := records.Diagnoses(id)
+	if err != nil {
+		writeRecordError(w, err, "")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// ListDiagnoses devuelve el historial completo; ?patientId= lo filtra.
+func ListDiagnoses(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(apiError{Error: "método no permitido"})
+		return
+	}
+	patientID := r.URL.Query().Get("patientId")
+	if patientID != "" {
+		patientID = toAtom(patientID)
+	}
+	out, err := records.Diagnoses(patientID)
+	if err != nil {
+		writeRecordError(w, err, "")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// handleDiagnosisRecord atiende /api/diagnoses/{id} y
+// /api/diagnoses/{id}/pdf, que vuelve a generar el PDF con los resultados
+// guardados, sin reevaluar las reglas.
+func handleDiagnosisRecord(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(apiError{Error: "método no permitido"})
+		return
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 3 || len(parts) > 4 || (len(parts) == 4 && parts[3] != "pdf") {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(apiError{Error: "ruta: /api/diagnoses/{id}[/pdf]"})
+		return
+	}
+	rec, err := records.Diagnosis(parts[2])
+	if err != nil {
+		writeRecordError(w, err, "no existe el diagnóstico")
+		return
+	}
+	if len(parts) == 3 {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rec)
+		return
+	}
+	b, err := renderDiagnosisPDF(rec.Output)
+	if err != nil {
+		http.Error(w, "error generando PDF", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", "attachment; filename=diagnostico-"+rec.ID+".pdf")
+	w.Write(b)
+}
+
+// DxInputOrigin lista qué valores aportó cada fuente. En Demographics van los
+// nombres de los campos.
+type DxInputOrigin struct {
+	Allergies          []string `json:"allergies"`
+	Chronics           []string `json:"chronics"`
+	CurrentMedications []string `json:"currentMedications"`
+	Demographics       []string `json:"demographics"`
+}
+
+// DxProvenance distingue lo que vino de la ficha del paciente de lo que vino
+// en la solicitud; un valor presente en ambas aparece en las dos listas.
+type DxProvenance struct {
+	FromProfile DxInputOrigin `json:"fromProfile"`
+	FromRequest DxInputOrigin `json:"fromRequest"`
+}
+
+// mergeAtoms une las dos listas sin repetir, primero las de la solicitud.
+func mergeAtoms(req, profile []string) (merged, fromReq, fromProfile []string) {
+	seen := map[string]bool{}
+	fromReq, fromProfile = []string{}, []string{}
+	for _, v := range req {
+		a := toAtom(v)
+		if !seen[a] {
+			seen[a] = true
+			merged = append(merged, a)
+			fromReq = append(fromReq, a)
+		}
+	}
+	for _, a := range profile {
+		fromProfile = append(fromProfile, a)
+		if !seen[a] {
+			seen[a] = true
+			merged = append(merged, a)
+		}
+	}
+	return merged, fromReq, fromProfile
+}
+
+// mergePatientProfile completa la entrada con la ficha del paciente: une
+// alergias, crónicas y medicación actual, y toma de la ficha los datos
+// demográficos que la solicitud no trae.
+func mergePatientProfile(in DiagnosisIn, p Patient) (DiagnosisIn, *DxProvenance) {
+	prov := &DxProvenance{}
+	in.Allergies, prov.FromRequest.Allergies, prov.FromProfile.Allergies = mergeAtoms(in.Allergies, p.Allergies)
+	in.Chronics, prov.FromRequest.Chronics, prov.FromProfile.Chronics = mergeAtoms(in.Chronics, p.Chronics)
+	in.CurrentMedications, prov.FromRequest.CurrentMedications, prov.FromProfile.CurrentMedications = mergeAtoms(in.CurrentMedications, p.CurrentMedications)
+
+	prov.FromRequest.Demographics, prov.FromProfile.Demographics = []string{}, []string{}
+	req, prof := in.Demographics, p.Demographics
+	if req == nil && prof == nil {
+		return in, prov
+	}
+	d := DxDemographics{}
+	if req != nil {
+		d = *req
+	}
+	if prof == nil {
+		prof = &DxDemographics{}
+	}
+	num := func(name string, dst **float64, pv *float64) {
+		switch {
+		case *dst != nil:
+			prov.FromRequest.Demographics = append(prov.FromRequest.Demographics, name)
+		case pv != nil:
+			*dst = pv
+			prov.FromProfile.Demographics = append(prov.FromProfile.Demographics, name)
+		}
+	}
+	num("ageYears", &d.AgeYears, prof.AgeYears)
+	num("weightKg", &d.WeightKg, prof.WeightKg)
+	num("creatinineClearance", &d.CreatinineClearance, prof.CreatinineClearance)
+	switch {
+	case d.Sex != "":
+		prov.FromRequest.Demographics = append(prov.FromRequest.Demographics, "sex")
+	case prof.Sex != "":
+		d.Sex = prof.Sex
+		prov.FromProfile.Demographics = append(prov.FromProfile.Demographics, "sex")
+	}
+	switch {
+	case d.Pregnant:
+		prov.FromRequest.Demographics = append(prov.FromRequest.Demographics, "pregnant")
+	case prof.Pregnant:
+		d.Pregnant = true
+		prov.FromProfile.Demographics = append(prov.FromProfile.Demographics, "pregnant")
+	}
+	var fromReq, fromProfile []string
+	d.RiskFactors, fromReq, fromProfile = mergeAtoms(d.RiskFactors, prof.RiskFactors)
+	if len(fromReq) > 0 {
+		prov.FromRequest.Demographics = append(prov.FromRequest.Demographics, "riskFactors")
+	}
+	if len(fromProfile) > 0 {
+		prov.FromProfile.Demographics = append(prov.FromProfile.Demographics, "riskFactors")
+	}
+	in.Demographics = &d
+	return in, prov
+}
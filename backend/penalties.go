@@ -0,0 +1,27 @@
+package main
+
+import "strconv"
+
+const (
+	predPenalty   = "penalizacion"
+	filePenalties = "prolog.pl"
+)
+
+// penalizacion(Enf, Sint, Peso) resta Peso a la afinidad ponderada cuando el
+// paciente niega tener el síntoma; es la contracara de enfermedad_sintoma/3.
+func InitPenalties() error {
+	return Register3(predPenalty, filePenalties)
+}
+
+// penaltyContributions devuelve las penalizaciones aplicadas como
+// contribuciones negativas, con la severidad "negado".
+func penaltyContributions(kb kbView, eID, denied string) ([]DxContribution, []DxRule) {
+	var contribs []DxContribution
+	var rules []DxRule
+	for _, s := range kb.ProveAll("penalizacion_aplicada(" + plAtom(eID) + "," + denied + ",S,P).") {
+		sid, p := plAtomOf(s.ByName_("S")), plNumberOf(s.ByName_("P"))
+		contribs = append(contribs, DxContribution{SymptomID: sid, Severity: "negado", Weight: round2dx(-p), Contribution: round2dx(-p)})
+		rules = append(rules, DxRule{Rule: "penalizacion/3", Details: eID + "," + sid + ",-" + strconv.FormatFloat(p, 'g', -1, 64)})
+	}
+	return contribs, rules
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// plClause es una cláusula tal como aparece en el archivo. Lead guarda los
+// espacios y comentarios previos para poder reescribir el archivo sin tocar
+// lo que no cambió.
+type plClause struct {
+	Lead  string
+	Text  string
+	Pred  string
+	Args  []string
+	Fact  bool
+	Arity int
+}
+
+type plDoc struct {
+	Clauses []plClause
+	Tail    string
+}
+
+func plParse(src string) *plDoc {
+	doc := &plDoc{}
+	start, clauseStart := 0, -1
+	i := 0
+	for i < len(src) {
+		ch := src[i]
+		switch {
+		case ch == '%':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			continue
+		case ch == '/' && i+1 < len(src) && src[i+1] == '*':
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				i = len(src)
+			} else {
+				i += end + 4
+			}
+			continue
+		case unicode.IsSpace(rune(ch)):
+			i++
+			continue
+		}
+		if clauseStart < 0 {
+			clauseStart = i
+		}
+		switch {
+		case ch == '\'' || ch == '"' || ch == '`':
+			i = plSkipQuoted(src, i)
+			continue
+		case ch == '.' && (i+1 == len(src) || unicode.IsSpace(rune(src[i+1])) || src[i+1] == '%'):
+			doc.Clauses = append(doc.Clauses, plNewClause(src[start:clauseStart], src[clauseStart:i+1]))
+			start, clauseStart = i+1, -1
+		}
+		i++
+	}
+	doc.Tail = src[start:]
+	return doc
+}
+
+func plSkipQuoted(src string, i int) int {
+	q := src[i]
+	i++
+	for i < len(src) {
+		switch src[i] {
+		case '\\':
+			i += 2
+			continue
+		case q:
+			if i+1 < len(src) && src[i+1] == q {
+				i += 2
+				continue
+			}
+			return i + 1
+		}
+		i++
+	}
+	return i
+}
+
+func plNewClause(lead, text string) plClause {
+	c := plClause{Lead: lead, Text: text}
+	body := strings.TrimSpace(strings.TrimSuffix(text, "."))
+	depth := 0
+	argStart := -1
+	for i := 0; i < len(body); i++ {
+		ch := body[i]
+		switch {
+		case ch == '\'' || ch == '"' || ch == '`':
+			i = plSkipQuoted(body, i) - 1
+		case ch == '(' || ch == '[' || ch == '{':
+			if depth == 0 && ch == '(' && c.Pred == "" && c.Args == nil {
+				c.Pred = strings.TrimSpace(body[:i])
+				argStart = i + 1
+			}
+			depth++
+		case ch == ')' || ch == ']' || ch == '}':
+			depth--
+			if depth == 0 && argStart >= 0 && c.Args == nil {
+				c.Args = plSplitArgs(body[argStart:i])
+				argStart = -1
+			}
+		case ch == ':' && depth == 0 && i+1 < len(body) && body[i+1] == '-':
+			if c.Pred == "" {
+				c.Pred = strings.TrimSpace(body[:i])
+			}
+			c.Arity = len(c.Args)
+			return c
+		}
+	}
+	if c.Pred == "" {
+		c.Pred = body
+	}
+	c.Arity = len(c.Args)
+	c.Fact = true
+	return c
+}
+
+func plSplitArgs(s string) []string {
+	var out []string
+	depth, last := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch ch := s[i]; {
+		case ch == '\'' || ch == '"' || ch == '`':
+			i = plSkipQuoted(s, i) - 1
+		case ch == '(' || ch == '[' || ch == '{':
+			depth++
+		case ch == ')' || ch == ']' || ch == '}':
+			depth--
+		case ch == ',' && depth == 0:
+			out = append(out, strings.TrimSpace(s[last:i]))
+			last = i + 1
+		}
+	}
+	return append(out, strings.TrimSpace(s[last:]))
+}
+
+// plNormArg normaliza un argumento para comparar "1.0" con "1" o "'Fiebre'"
+// con "fiebre". Sin el esquema a mano, solo un número escrito como número en
+// Prolog cuenta como tal: "infinity" o '1.0' son átomos.
+func plNormArg(a string) string {
+	if plNumberLit.MatchString(strings.TrimSpace(a)) {
+		if n, ok := normalizeNumber(a); ok {
+			return n
+		}
+	}
+	return toAtom(trimQuotes(a))
+}
+
+func (c plClause) key() string {
+	args := make([]string, len(c.Args))
+	for i, a := range c.Args {
+		args[i] = plNormArg(a)
+	}
+	return c.Pred + "(" + strings.Join(args, ",") + ")"
+}
+
+func (d *plDoc) String() string {
+	var b strings.Builder
+	for _, c := range d.Clauses {
+		b.WriteString(c.Lead)
+		b.WriteString(c.Text)
+	}
+	b.WriteString(d.Tail)
+	return b.String()
+}
+
+// facts devuelve los argumentos normalizados de los hechos pred/arity.
+func (d *plDoc) facts(pred string, arity int) [][]string {
+	var out [][]string
+	for _, c := range d.Clauses {
+		if !c.Fact || c.Pred != pred || c.Arity != arity {
+			continue
+		}
+		args := make([]string, arity)
+		for i, a := range c.Args {
+			args[i] = plNormArg(a)
+		}
+		out = append(out, args)
+	}
+	return out
+}
+
+// replaceFacts deja en el documento exactamente los hechos pred/arity dados.
+// Los que ya estaban conservan su texto y posición; los nuevos se insertan
+// después del último hecho del mismo predicado. Todo lo demás queda igual.
+func (d *plDoc) replaceFacts(pred string, arity int, facts [][]string) {
+	want := map[string]bool{}
+	var fresh []plClause
+	for _, args := range facts {
+		c := plNewClause("\n", Fact{Pred: pred, Args: args}.Clause())
+		if want[c.key()] {
+			continue
+		}
+		want[c.key()] = true
+		fresh = append(fresh, c)
+	}
+
+	out := make([]plClause, 0, len(d.Clauses)+len(fresh))
+	seen := map[string]bool{}
+	last := -1
+	pendingLead := ""
+	for _, c := range d.Clauses {
+		if c.Fact && c.Pred == pred && c.Arity == arity {
+			k := c.key()
+			if !want[k] || seen[k] {
+				// se conserva cualquier comentario que precedía al hecho borrado
+				if strings.TrimSpace(c.Lead) != "" {
+					pendingLead += c.Lead
+				}
+				continue
+			}
+			seen[k] = true
+			last = len(out)
+		}
+		if pendingLead != "" {
+			c.Lead = pendingLead + c.Lead
+			pendingLead = ""
+		}
+		out = append(out, c)
+	}
+	if pendingLead != "" {
+		d.Tail = pendingLead + d.Tail
+	}
+
+	var add []plClause
+	for _, c := range fresh {
+		if !seen[c.key()] {
+			add = append(add, c)
+		}
+	}
+	sort.SliceStable(add, func(i, j int) bool { return add[i].Text < add[j].Text })
+	if last < 0 {
+		last = len(out) - 1
+	}
+	if len(out) == 0 && len(add) > 0 {
+		add[0].Lead = ""
+	}
+	d.Clauses = append(out[:last+1], append(add, out[last+1:]...)...)
+	if len(d.Clauses) > 0 && !strings.HasPrefix(d.Tail, "\n") && strings.TrimSpace(d.Tail) == "" {
+		d.Tail = "\n"
+	}
+}
+
+func plReadDoc(file string) (*plDoc, error) {
+	src, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return plParse(string(src)), nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const plSample = `% base de ejemplo
+sintoma(fiebre).
+sintoma(tos).
+
+/* pesos */
+enfermedad_sintoma(gripe, fiebre, 0.30).
+% la tos pesa menos
+enfermedad_sintoma(gripe, tos, 0.2).
+
+afinidad(E, S, T) :- findall(W, (member(X, S), enfermedad_sintoma(E, X, W)), Ws), sum_list(Ws, T).
+`
+
+// TestPlDocReplaceFacts reescribe un archivo con reglas y comentarios y
+// comprueba que solo cambien los hechos del predicado reemplazado.
+func TestPlDocReplaceFacts(t *testing.T) {
+	tests := []struct {
+		name  string
+		pred  string
+		arity int
+		facts [][]string
+		want  string
+	}{
+		{
+			name:  "mismos hechos deja el archivo igual",
+			pred:  "enfermedad_sintoma",
+			arity: 3,
+			facts: [][]string{{"gripe", "fiebre", "0.3"}, {"gripe", "tos", "0.2"}},
+			want:  plSample,
+		},
+		{
+			name:  "un hecho nuevo va después del último del predicado",
+			pred:  "sintoma",
+			arity: 1,
+			facts: [][]string{{"fiebre"}, {"tos"}, {"cansancio"}},
+			want: `% base de ejemplo
+sintoma(fiebre).
+sintoma(tos).
+sintoma(cansancio).
+
+/* pesos */
+enfermedad_sintoma(gripe, fiebre, 0.30).
+% la tos pesa menos
+enfermedad_sintoma(gripe, tos, 0.2).
+
+afinidad(E, S, T) :- findall(W, (member(X, S), enfermedad_sintoma(E, X, W)), Ws), sum_list(Ws, T).
+`,
+		},
+		{
+			name:  "un borrado conserva el comentario que lo precedía",
+			pred:  "enfermedad_sintoma",
+			arity: 3,
+			facts: [][]string{{"gripe", "fiebre", "0.3"}},
+			want: `% base de ejemplo
+sintoma(fiebre).
+sintoma(tos).
+
+/* pesos */
+enfermedad_sintoma(gripe, fiebre, 0.30).
+% la tos pesa menos
+
+
+afinidad(E, S, T) :- findall(W, (member(X, S), enfermedad_sintoma(E, X, W)), Ws), sum_list(Ws, T).
+`,
+		},
+		{
+			name:  "vaciar un predicado no toca las reglas que lo usan",
+			pred:  "enfermedad_sintoma",
+			arity: 3,
+			facts: nil,
+			want: `% base de ejemplo
+sintoma(fiebre).
+sintoma(tos).
+
+/* pesos */
+
+% la tos pesa menos
+
+
+afinidad(E, S, T) :- findall(W, (member(X, S), enfermedad_sintoma(E, X, W)), Ws), sum_list(Ws, T).
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "prolog.pl")
+			if err := os.WriteFile(file, []byte(plSample), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			doc, err := plReadDoc(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			doc.replaceFacts(tt.pred, tt.arity, tt.facts)
+			if got := doc.String(); got != tt.want {
+				t.Errorf("resultado:\n%s\nesperado:\n%s", got, tt.want)
+			}
+			if got := len(plParse(doc.String()).facts(tt.pred, tt.arity)); got != len(tt.facts) {
+				t.Errorf("quedaron %d hechos de %s, se esperaban %d", got, tt.pred, len(tt.facts))
+			}
+		})
+	}
+}
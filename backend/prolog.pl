@@ -25,11 +25,166 @@ trata(gripe, paracetamol).
 trata(migrana, ibuprofeno).
 trata(asma, salbutamol).
 trata(covid19, paracetamol).
-urgencia(Severidades, consulta_medica_inmediata_sugerida) :- member(severo, Severidades), !.
-urgencia(Severidades, observacion_recomendada) :- member(moderado, Severidades), !.
-urgencia(_, posible_automanejo).
+urgencia(Severidades, U) :- findall(U0, (member(Sev, Severidades), nivel_severidad(Sev, _, _, U0)), Us), urgencia_maxima(Us, U).
+urgencia_maxima(Us, U) :- member(U, Us), rango_urgencia(U, R), \+ (member(U2, Us), rango_urgencia(U2, R2), R2 > R), !.
+urgencia_maxima(_, posible_automanejo).
+rango_severidad(Sev, R) :- nivel_severidad(Sev, _, R, _).
+severidad_por_intensidad(I, Sev) :- nivel_severidad(Sev, _, Min, _), I >= Min, \+ (nivel_severidad(_, _, Min2, _), I >= Min2, Min2 > Min), !.
+rango_urgencia(posible_automanejo, 1).
+rango_urgencia(observacion_recomendada, 2).
+rango_urgencia(consulta_medica_inmediata_sugerida, 3).
+sintoma_con_severidad(Sintomas, Sint, Min) :- member(s(Sint, Sev, _, _), Sintomas), rango_severidad(Sev, R), rango_severidad(Min, RMin), R >= RMin.
+condicion_bandera(ninguna, _) :- !.
+condicion_bandera(Cond, Perfil) :- condicion_paciente(Perfil, Cond), !.
+bandera_cumple(Id, Sintomas, Min) :- \+ (bandera_sintoma(Id, Sint), \+ sintoma_con_severidad(Sintomas, Sint, Min)).
+bandera_activa(Sintomas, Perfil, Id, U) :- bandera_roja(Id, U, Min, Cond), \+ \+ bandera_sintoma(Id, _), bandera_cumple(Id, Sintomas, Min), condicion_bandera(Cond, Perfil).
+bandera_de_enfermedad(Enf, Id) :- bandera_sintoma(Id, Sint), enfermedad_sintoma(Enf, Sint, _), !.
+comparte_sintoma(Enf, Sintomas) :- member(s(Sint, _, _, _), Sintomas), enfermedad_sintoma(Enf, Sint, _), !.
+severidades_enfermedad(Enf, Sintomas, Sevs) :- findall(Sev, (member(s(Sint, Sev, _, _), Sintomas), enfermedad_sintoma(Enf, Sint, _)), Sevs).
+candidata_urgencia(Enf, Sintomas, Perfil, U, bandera_roja, Id) :- bandera_activa(Sintomas, Perfil, Id, U), bandera_de_enfermedad(Enf, Id).
+candidata_urgencia(Enf, Sintomas, _, U, escalada_urgencia, Sint) :- escalada_urgencia(Enf, Sint, Min, U), sintoma_con_severidad(Sintomas, Sint, Min).
+candidata_urgencia(Enf, Sintomas, _, U, urgencia_base, Enf) :- urgencia_base(Enf, U), severidades_enfermedad(Enf, Sintomas, [_|_]).
+candidata_urgencia(Enf, Sintomas, _, U, urgencia, Enf) :- severidades_enfermedad(Enf, Sintomas, Sevs), urgencia(Sevs, U).
+urgencia_enfermedad(Enf, Sintomas, Perfil, U, Regla, Det) :- candidata_urgencia(Enf, Sintomas, Perfil, U, Regla, Det), rango_urgencia(U, R), \+ (candidata_urgencia(Enf, Sintomas, Perfil, U2, _, _), rango_urgencia(U2, R2), R2 > R), !.
+factor_severidad(Sev, F) :- nivel_severidad(Sev, F, _, _).
+factor_aplicado(Sev, F) :- factor_severidad(Sev, F), !.
+factor_aplicado(_, 1.0).
+factor_temporal(duracion_dentro, 1.2).
+factor_temporal(duracion_fuera, 0.6).
+factor_temporal(inicio_coincide, 1.1).
+factor_temporal(inicio_distinto, 0.8).
+encaje_duracion(D, Min, Max, duracion_dentro) :- D >= Min, D =< Max, !.
+encaje_duracion(_, _, _, duracion_fuera).
+encaje_inicio(I, I, inicio_coincide) :- !.
+encaje_inicio(_, _, inicio_distinto).
+detalle_duracion(Enf, Sint, Dias, Min, Max, E, F) :- Dias \== desconocido, duracion_tipica(Enf, Sint, Min, Max), encaje_duracion(Dias, Min, Max, E), factor_temporal(E, F).
+detalle_inicio(Enf, Sint, Ini, Tipico, E, F) :- Ini \== desconocido, inicio_tipico(Enf, Sint, Tipico), encaje_inicio(Ini, Tipico, E), factor_temporal(E, F).
+ajuste_duracion(Enf, Sint, Dias, F) :- detalle_duracion(Enf, Sint, Dias, _, _, _, F), !.
+ajuste_duracion(_, _, _, 1).
+ajuste_inicio(Enf, Sint, Ini, F) :- detalle_inicio(Enf, Sint, Ini, _, _, F), !.
+ajuste_inicio(_, _, _, 1).
+ajuste_temporal(Enf, Sint, Ini, Dias, F) :- ajuste_duracion(Enf, Sint, Dias, FD), ajuste_inicio(Enf, Sint, Ini, FI), F is FD * FI.
+contribucion(Enf, Sintomas, Sint, Sev, W, C) :- member(s(Sint, Sev, Ini, Dias), Sintomas), enfermedad_sintoma(Enf, Sint, W), factor_aplicado(Sev, F), ajuste_temporal(Enf, Sint, Ini, Dias, FT), C is W * F * FT.
+suma_lista([], 0).
+suma_lista([X|Xs], S) :- suma_lista(Xs, S0), S is S0 + X.
+tope_afinidad(T, 1.0) :- T > 1.0, !.
+tope_afinidad(T, T).
+afinidad_base(Enf, Sintomas, T) :- enfermedad(Enf, _), findall(C, contribucion(Enf, Sintomas, _, _, _, C), Cs), suma_lista(Cs, T).
+condicion_paciente(perfil(_, _, _, Factores), F) :- member(F, Factores).
+condicion_paciente(perfil(_, Sexo, _, _), Sexo) :- Sexo \== desconocido.
+condicion_paciente(perfil(_, _, si, _), embarazo).
+condicion_paciente(perfil(Edad, _, _, _), pediatrico) :- Edad \== desconocido, Edad < 18.
+condicion_paciente(perfil(Edad, _, _, _), adulto_mayor) :- Edad \== desconocido, Edad >= 65.
+modificador_aplicado(Enf, Perfil, Cond, F) :- condicion_paciente(Perfil, Cond), modificador(Enf, Cond, F).
+producto_lista([], 1).
+producto_lista([X|Xs], P) :- producto_lista(Xs, P0), P is P0 * X.
+penalizacion_aplicada(Enf, Negados, Sint, P) :- member(Sint, Negados), penalizacion(Enf, Sint, P).
+afinidad_modificada(Enf, Sintomas, Negados, Perfil, Total) :- afinidad_base(Enf, Sintomas, T), findall(P, penalizacion_aplicada(Enf, Negados, _, P), Ps), suma_lista(Ps, Pen), T0 is T - Pen, maximo(T0, 0, T1), findall(F, modificador_aplicado(Enf, Perfil, _, F), Fs), producto_lista(Fs, M), T2 is T1 * M, tope_afinidad(T2, Total).
+maximo(A, B, A) :- A >= B, !.
+maximo(_, B, B).
+prior(Enf, P) :- prevalencia(Enf, P), !.
+prior(_, 0.05).
+sensibilidad_sin_dato(0.1).
+acotar(X, Min, Max, Y) :- maximo(X, Min, X1), minimo(X1, Max, Y).
+sensibilidad_efectiva(Enf, S, Se) :- sensibilidad(Enf, S, Se0, _), !, acotar(Se0, 0.01, 0.99, Se).
+sensibilidad_efectiva(_, _, Se) :- sensibilidad_sin_dato(Se).
+probabilidad_hallazgo(Enf, S, presente, Se) :- sensibilidad_efectiva(Enf, S, Se).
+probabilidad_hallazgo(Enf, S, ausente, L) :- sensibilidad_efectiva(Enf, S, Se), L is 1 - Se.
+razon_verosimilitud(Enf, S, presente, LR) :- sensibilidad(Enf, S, Se, Sp), !, D0 is 1 - Sp, maximo(D0, 0.01, D), LR is Se / D.
+razon_verosimilitud(Enf, S, ausente, LR) :- sensibilidad(Enf, S, Se, Sp), !, maximo(Sp, 0.01, D), LR is (1 - Se) / D.
+lr_informada(Enf, S, Estado, LR) :- razon_verosimilitud(Enf, S, Estado, LR), !.
+lr_informada(_, _, _, 0).
+detalle_hallazgo(Enf, Hallazgos, S, Estado, L, LR) :- member(h(S, Estado), Hallazgos), probabilidad_hallazgo(Enf, S, Estado, L), lr_informada(Enf, S, Estado, LR).
+conjunta_bayes(Enf, Hallazgos, Perfil, J) :- enfermedad(Enf, _), prior(Enf, P), findall(L, detalle_hallazgo(Enf, Hallazgos, _, _, L, _), Ls), producto_lista(Ls, M), findall(F, modificador_aplicado(Enf, Perfil, _, F), Fs), producto_lista(Fs, Mod), J is P * M * Mod.
+interaccion_bloquea(grave).
+interactua(A, B, S) :- interaccion(A, B, S).
+interactua(A, B, S) :- interaccion(B, A, S).
+exclusion(Med, paciente(Alergias, _, _, _), alergia(Med)) :- member(Med, Alergias).
+exclusion(Med, paciente(_, Cronicas, _, _), contra(Med, Cr)) :- member(Cr, Cronicas), contraindicacion(Med, Cr).
+exclusion(Med, paciente(_, _, Actuales, _), interaccion(Med, Otro, S)) :- member(Otro, Actuales), interactua(Med, Otro, S), interaccion_bloquea(S).
+exclusion(Med, paciente(_, _, _, datos(_, _, ClCr)), renal(Med, ClCr)) :- factor_renal(Med, ClCr, F), 0 =:= F.
+advertencia(Med, paciente(_, _, Actuales, _), interaccion(Med, Otro, S)) :- member(Otro, Actuales), interactua(Med, Otro, S), \+ interaccion_bloquea(S).
+motivo_exclusion(Med, Paciente, Motivo) :- exclusion(Med, Paciente, Motivo), !.
+prioridad(Enf, Med, P) :- prioridad_tratamiento(Enf, Med, P), !.
+prioridad(_, _, 100).
+valores([], []).
+valores([_-V|Ps], [V|Vs]) :- valores(Ps, Vs).
+tratamientos_ordenados(Enf, Meds) :- findall(P-M, (trata(Enf, M), prioridad(Enf, M, P)), Ps), msort(Ps, Ordenados), valores(Ordenados, Meds).
+estado_tratamiento(Med, Paciente, Motivo) :- motivo_exclusion(Med, Paciente, Motivo), !.
+estado_tratamiento(_, _, seguro).
+opcion_tratamiento(Enf, Paciente, Med, P, Estado) :- tratamientos_ordenados(Enf, Meds), member(Med, Meds), prioridad(Enf, Med, P), estado_tratamiento(Med, Paciente, Estado).
+minimo(A, B, A) :- A =< B, !.
+minimo(_, B, B).
+grupo_edad(Edad, pediatrico) :- Edad < 18, !.
+grupo_edad(_, adulto).
+dosis_base(MgKg, Max, _, Max) :- MgKg =:= 0, !.
+dosis_base(MgKg, Max, Peso, D) :- Peso > 0, D0 is MgKg * Peso, minimo(D0, Max, D).
+factor_renal(Med, ClCr, F) :- ClCr > 0, findall(Fa, (ajuste_renal(Med, Limite, Fa), ClCr < Limite), Fs), msort(Fs, [F|_]), !.
+factor_renal(_, _, 1.0).
+dosis_recomendada(Med, datos(Edad, Peso, ClCr), Grupo, Dosis, Intervalo, Diaria, Factor) :- Edad \== desconocido, grupo_edad(Edad, Grupo), dosis(Med, Grupo, MgKg, Max, MaxDiaria, Intervalo), dosis_base(MgKg, Max, Peso, D0), factor_renal(Med, ClCr, Factor), Factor > 0, Dosis is D0 * Factor, D1 is Dosis * 24 / Intervalo, minimo(D1, MaxDiaria, Diaria).
 medicamento(paracetamol,paracetamol).
 medicamento(ibuprofeno,ibuprofeno).
 medicamento(salbutamol,salbutamol).
 contraindicacion(ibuprofeno,hipertension).
 contraindicacion(salbutamol,diabetes).
+dosis(paracetamol,pediatrico,15,1000,4000,6).
+dosis(paracetamol,adulto,0,1000,4000,6).
+dosis(ibuprofeno,pediatrico,10,400,1200,8).
+dosis(ibuprofeno,adulto,0,400,1200,8).
+dosis(salbutamol,pediatrico,0.15,5,20,6).
+dosis(salbutamol,adulto,0,5,20,6).
+ajuste_renal(paracetamol,10,0.5).
+ajuste_renal(ibuprofeno,30,0).
+modificador(asma,fumador,1.3).
+modificador(covid19,inmunocomprometido,1.3).
+modificador(covid19,viaje_reciente,1.2).
+modificador(covid19,adulto_mayor,1.2).
+modificador(gripe,inmunocomprometido,1.2).
+modificador(migrana,femenino,1.2).
+prevalencia(gripe,0.1).
+prevalencia(covid19,0.05).
+prevalencia(migrana,0.12).
+prevalencia(asma,0.08).
+sensibilidad(gripe,fiebre,0.85,0.7).
+sensibilidad(gripe,tos,0.8,0.6).
+sensibilidad(gripe,dolor_cabeza,0.6,0.6).
+sensibilidad(gripe,cansancio,0.7,0.5).
+sensibilidad(covid19,fiebre,0.8,0.65).
+sensibilidad(covid19,tos,0.7,0.6).
+sensibilidad(covid19,dificultad_respirar,0.4,0.9).
+sensibilidad(migrana,dolor_cabeza,0.95,0.7).
+sensibilidad(migrana,cansancio,0.5,0.5).
+sensibilidad(asma,dificultad_respirar,0.9,0.85).
+sensibilidad(asma,tos,0.7,0.6).
+penalizacion(gripe,fiebre,0.2).
+penalizacion(covid19,fiebre,0.15).
+penalizacion(covid19,dificultad_respirar,0.1).
+penalizacion(migrana,dolor_cabeza,0.5).
+penalizacion(asma,dificultad_respirar,0.4).
+duracion_tipica(gripe,fiebre,2,5).
+duracion_tipica(gripe,tos,3,10).
+duracion_tipica(covid19,fiebre,3,10).
+duracion_tipica(covid19,tos,5,21).
+duracion_tipica(covid19,dificultad_respirar,5,14).
+duracion_tipica(migrana,dolor_cabeza,0,3).
+duracion_tipica(asma,dificultad_respirar,0,2).
+duracion_tipica(asma,tos,7,60).
+inicio_tipico(gripe,fiebre,subito).
+inicio_tipico(covid19,fiebre,gradual).
+inicio_tipico(covid19,dificultad_respirar,gradual).
+inicio_tipico(migrana,dolor_cabeza,subito).
+inicio_tipico(asma,dificultad_respirar,subito).
+bandera_roja(disnea,consulta_medica_inmediata_sugerida,leve,ninguna).
+bandera_sintoma(disnea,dificultad_respirar).
+bandera_roja(fiebre_tos_adulto_mayor,consulta_medica_inmediata_sugerida,moderado,adulto_mayor).
+bandera_sintoma(fiebre_tos_adulto_mayor,fiebre).
+bandera_sintoma(fiebre_tos_adulto_mayor,tos).
+bandera_roja(cefalea_embarazo,consulta_medica_inmediata_sugerida,moderado,embarazo).
+bandera_sintoma(cefalea_embarazo,dolor_cabeza).
+urgencia_base(covid19,observacion_recomendada).
+urgencia_base(asma,observacion_recomendada).
+escalada_urgencia(covid19,dificultad_respirar,leve,consulta_medica_inmediata_sugerida).
+escalada_urgencia(asma,dificultad_respirar,severo,consulta_medica_inmediata_sugerida).
+nivel_severidad(leve,0.8,0,posible_automanejo).
+nivel_severidad(moderado,1.0,4,observacion_recomendada).
+nivel_severidad(severo,1.2,7,consulta_medica_inmediata_sugerida).
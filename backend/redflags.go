@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+const (
+	predRedFlag    = "bandera_roja"
+	predRedFlagSym = "bandera_sintoma"
+	fileRedFlags   = "prolog.pl"
+)
+
+// bandera_roja(Id, Urgencia, SeveridadMinima, Condicion) se activa cuando
+// todos sus bandera_sintoma(Id, Sint) están presentes con al menos esa
+// severidad y el paciente cumple la condición (ninguna = cualquiera). La
+// evaluación está en bandera_activa/4 de prolog.pl.
+var schemaRedFlag = []ArgType{ArgAtom, ArgAtom, ArgAtom, ArgAtom}
+
+var urgencyLevels = map[string]bool{
+	"posible_automanejo":                 true,
+	"observacion_recomendada":            true,
+	"consulta_medica_inmediata_sugerida": true,
+}
+
+type RedFlagIn struct {
+	ID          string   `json:"id"`
+	Urgency     string   `json:"urgency"`
+	MinSeverity string   `json:"minSeverity,omitempty"`
+	Condition   string   `json:"condition,omitempty"`
+	Symptoms    []string `json:"symptoms"`
+}
+
+type RedFlagOut struct {
+	ID          string   `json:"id"`
+	Urgency     string   `json:"urgency"`
+	MinSeverity string   `json:"minSeverity"`
+	Condition   string   `json:"condition"`
+	Symptoms    []string `json:"symptoms"`
+}
+
+func InitRedFlags() error {
+	if err := KBRegister(PredSchema{Name: predRedFlag, Types: schemaRedFlag}, fileRedFlags); err != nil {
+		return err
+	}
+	return Register2(predRedFlagSym, fileRedFlags)
+}
+
+// validRedFlag completa los valores por omisión y responde 400 si algo no
+// es válido.
+func validRedFlag(w http.ResponseWriter, in *RedFlagIn) bool {
+	if in.MinSeverity == "" {
+		in.MinSeverity = "leve"
+	}
+	if in.Condition == "" {
+		in.Condition = "ninguna"
+	}
+	msg := ""
+	switch {
+	case strings.TrimSpace(in.ID) == "" || len(in.Symptoms) == 0:
+		msg = "id y symptoms son obligatorios"
+	case !urgencyLevels[toAtom(in.Urgency)]:
+		msg = "urgency debe ser una de: " + strings.Join(sortedKeys(urgencyLevels), ", ")
+	case !severityLevelSet()[toAtom(in.MinSeverity)]:
+		msg = "minSeverity debe ser una de: " + strings.Join(sortedKeys(severityLevelSet()), ", ")
+	case toAtom(in.Condition) != "ninguna" && !patientConditions[toAtom(in.Condition)]:
+		msg = "condition debe ser ninguna o una de: " + strings.Join(sortedKeys(patientConditions), ", ")
+	}
+	if msg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(apiError{Error: msg})
+		return false
+	}
+	return true
+}
+
+func readRedFlags(flags, syms []Fact) []RedFlagOut {
+	out := make([]RedFlagOut, 0, len(flags))
+	for _, f := range flags {
+		rf := RedFlagOut{ID: f.Args[0], Urgency: f.Args[1], MinSeverity: f.Args[2], Condition: f.Args[3], Symptoms: []string{}}
+		for _, s := range syms {
+			if s.Args[0] == rf.ID {
+				rf.Symptoms = append(rf.Symptoms, s.Args[1])
+			}
+		}
+		out = append(out, rf)
+	}
+	return out
+}
+
+func findRedFlag(tx *KBTx, id string) (Fact, bool) {
+	id = toAtom(id)
+	for _, f := range tx.Facts(predRedFlag) {
+		if f.Args[0] == id {
+			return f, true
+		}
+	}
+	return Fact{}, false
+}
+
+func assertRedFlag(tx *KBTx, in RedFlagIn) (RedFlagOut, error) {
+	if _, found := findRedFlag(tx, in.ID); found {
+		return RedFlagOut{}, errKBExists
+	}
+	f, err := tx.Assert(predRedFlag, in.ID, in.Urgency, in.MinSeverity, in.Condition)
+	if err != nil {
+		return RedFlagOut{}, err
+	}
+	for _, s := range in.Symptoms {
+		if _, err := tx.Assert(predRedFlagSym, f.Args[0], s); err != nil && !errors.Is(err, errKBExists) {
+			return RedFlagOut{}, err
+		}
+	}
+	return readRedFlags([]Fact{f}, tx.Facts(predRedFlagSym))[0], nil
+}
+
+func retractRedFlag(tx *KBTx, f Fact) error {
+	for _, s := range tx.Facts(predRedFlagSym) {
+		if s.Args[0] == f.Args[0] {
+			if _, err := tx.Retract(predRedFlagSym, s.Args...); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := tx.Retract(predRedFlag, f.Args...)
+	return err
+}
+
+func ListRedFlags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(apiError{Error: "método no permitido"})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(readRedFlags(KBList(predRedFlag), KBList(predRedFlagSym)))
+}
+
+func CreateRedFlag(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(apiError{Error: "método no permitido"})
+		return
+	}
+	var in RedFlagIn
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(apiError{Error: "JSON inválido"})
+		return
+	}
+	if !validRedFlag(w, &in) {
+		return
+	}
+	var out RedFlagOut
+	err := KBApply(r.Context(), func(tx *KBTx) error {
+		var err error
+		out, err = assertRedFlag(tx, in)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, errKBExists) {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(apiError{Error: "la bandera roja ya existe"})
+			return
+		}
+		writeKBError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(out)
+}
+
+func UpdateRedFlag(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut && r.Method != http.MethodPatch {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(apiError{Error: "método no permitido"})
+		return
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 3 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(apiError{Error: "ruta: /api/redflags/{id}"})
+		return
+	}
+	oldID := parts[2]
+	var in RedFlagIn
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(apiError{Error: "JSON inválido"})
+		return
+	}
+	if strings.TrimSpace(in.ID) == "" {
+		in.ID = oldID
+	}
+	if !validRedFlag(w, &in) {
+		return
+	}
+	var out RedFlagOut
+	err := KBApply(r.Context(), func(tx *KBTx) error {
+		cur, found := findRedFlag(tx, oldID)
+		if !found {
+			return errKBNotFound
+		}
+		if err := retractRedFlag(tx, cur); err != nil {
+			return err
+		}
+		var err error
+		out, err = assertRedFlag(tx, in)
+		return err
+	})
+	if err != nil {
+		switch kbWhy(err) {
+		case "not_found":
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(apiError{Error: "no existe la bandera roja a actualizar"})
+		case "conflict":
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(apiError{Error: "ya existe una bandera roja con ese id"})
+		default:
+			writeKBError(w, err)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+func DeleteRedFlag(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(apiError{Error: "método no permitido"})
+		return
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 3 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(apiError{Error: "ruta: /api/redflags/{id}"})
+		return
+	}
+	err := KBApply(r.Context(), func(tx *KBTx) error {
+		cur, found := findRedFlag(tx, parts[2])
+		if !found {
+			return errKBNotFound
+		}
+		return retractRedFlag(tx, cur)
+	})
+	if err != nil {
+		if errors.Is(err, errKBNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(apiError{Error: "no existe la bandera roja"})
+			return
+		}
+		writeKBError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	predSeverity   = "nivel_severidad"
+	fileSeverities = "prolog.pl"
+)
+
+// nivel_severidad(Nivel, Factor, IntensidadMin, Urgencia): Factor multiplica
+// el peso del síntoma, IntensidadMin es el inicio de la banda en la escala
+// 0–10 (la banda llega hasta el siguiente nivel) y Urgencia es la que sugiere
+// urgencia/2 cuando aparece ese nivel. El orden de los niveles sale de
+// IntensidadMin.
+var schemaSeverity = []ArgType{ArgAtom, ArgNumber, ArgNumber, ArgAtom}
+
+type SeverityIn struct {
+	ID           string   `json:"id"`
+	Factor       *float64 `json:"factor"`
+	MinIntensity *float64 `json:"minIntensity"`
+	Urgency      string   `json:"urgency"`
+}
+
+type SeverityOut struct {
+	ID           string  `json:"id"`
+	Factor       float64 `json:"factor"`
+	MinIntensity float64 `json:"minIntensity"`
+	Urgency      string  `json:"urgency"`
+}
+
+func InitSeverities() error {
+	return KBRegister(PredSchema{Name: predSeverity, Types: schemaSeverity}, fileSeverities)
+}
+
+func severityOut(f Fact) SeverityOut {
+	factor, _ := strconv.ParseFloat(f.Args[1], 64)
+	min, _ := strconv.ParseFloat(f.Args[2], 64)
+	return SeverityOut{ID: f.Args[0], Factor: factor, MinIntensity: min, Urgency: f.Args[3]}
+}
+
+// severityLevelSet devuelve los niveles configurados en la base.
+func severityLevelSet() map[string]bool {
+	out := map[string]bool{}
+	for _, f := range KBList(predSeverity) {
+		out[f.Args[0]] = true
+	}
+	return out
+}
+
+// severityForIntensity traduce una intensidad 0–10 al nivel cuya banda la
+// contiene (severidad_por_intensidad/2); "" si no hay niveles.
+func severityForIntensity(kb kbView, v float64) string {
+	sols := kb.ProveAll("severidad_por_intensidad(" + strconv.FormatFloat(v, 'f', -1, 64) + ",S).")
+	if len(sols) == 0 {
+		return ""
+	}
+	return plAtomOf(sols[0].ByName_("S"))
+}
+
+func findSeverity(tx *KBTx, id string) (Fact, bool) {
+	id = toAtom(id)
+	for _, f := range tx.Facts(predSeverity) {
+		if f.Args[0] == id {
+			return f, true
+		}
+	}
+	return Fact{}, false
+}
+
+func validSeverity(w http.ResponseWriter, in SeverityIn) bool {
+	msg := ""
+	switch {
+	case strings.TrimSpace(in.ID) == "" || in.Factor == nil || in.MinIntensity == nil:
+		msg = "id, factor y minIntensity son obligatorios"
+	case *in.Factor <= 0:
+		msg = "factor debe ser mayor que 0"
+	case *in.MinIntensity < 0 || *in.MinIntensity > 10:
+		msg = "minIntensity debe estar entre 0 y 10"
+	case !urgencyLevels[toAtom(in.Urgency)]:
+		msg = "urgency debe ser una de: " + strings.Join(sortedKeys(urgencyLevels), ", ")
+	}
+	if msg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(apiError{Error: msg})
+		return false
+	}
+	return true
+}
+
+// severityArgs arma los argumentos del hecho y rechaza dos niveles con la
+// misma intensidad mínima, porque la banda quedaría ambigua.
+func severityArgs(tx *KBTx, in SeverityIn, except string) ([]string, error) {
+	for _, f := range tx.Facts(predSeverity) {
+		if f.Args[0] == except {
+			continue
+		}
+		if v, _ := strconv.ParseFloat(f.Args[2], 64); v == *in.MinIntensity {
+			return nil, errKBExists
+		}
+	}
+	return []string{in.ID, strconv.FormatFloat(*in.Factor, 'g', -1, 64), strconv.FormatFloat(*in.MinIntensity, 'g', -1, 64), in.Urgency}, nil
+}
+
+func ListSeverities(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(apiError{Error: "método no permitido"})
+		return
+	}
+	out := []SeverityOut{}
+	for _, f := range KBList(predSeverity) {
+		out = append(out, severityOut(f))
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].MinIntensity < out[j].MinIntensity })
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+func CreateSeverity(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(apiError{Error: "método no permitido"})
+		return
+	}
+	var in SeverityIn
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(apiError{Error: "JSON inválido"})
+		return
+	}
+	if !validSeverity(w, in) {
+		return
+	}
+	var out SeverityOut
+	err := KBApply(r.Context(), func(tx *KBTx) error {
+		if _, found := findSeverity(tx, in.ID); found {
+			return errKBExists
+		}
+		args, err := severityArgs(tx, in, "")
+		if err != nil {
+			return err
+		}
+		f, err := tx.Assert(predSeverity, args...)
+		out = severityOut(f)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, errKBExists) {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(apiError{Error: "ya existe un nivel con ese id o esa intensidad mínima"})
+			return
+		}
+		writeKBError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(out)
+}
+
+func UpdateSeverity(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut && r.Method != http.MethodPatch {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(apiError{Error: "método no permitido"})
+		return
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 3 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(apiError{Error: "ruta: /api/severities/{id}"})
+		return
+	}
+	oldID := parts[2]
+	var in SeverityIn
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(apiError{Error: "JSON inválido"})
+		return
+	}
+	if strings.TrimSpace(in.ID) == "" {
+		in.ID = oldID
+	}
+	if !validSeverity(w, in) {
+		return
+	}
+	var out SeverityOut
+	err := KBApply(r.Context(), func(tx *KBTx) error {
+		cur, found := findSeverity(tx, oldID)
+		if !found {
+			return errKBNotFound
+		}
+		if toAtom(in.ID) != cur.Args[0] {
+			if _, found := findSeverity(tx, in.ID); found {
+				return errKBExists
+			}
+		}
+		args, err := severityArgs(tx, in, cur.Args[0])
+		if err != nil {
+			return err
+		}
+		f, err := tx.Update(predSeverity, cur.Args, args)
+		out = severityOut(f)
+		return err
+	})
+	if err != nil {
+		switch kbWhy(err) {
+		case "not_found":
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(apiError{Error: "no existe el nivel de severidad a actualizar"})
+		case "conflict":
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(apiError{Error: "ya existe un nivel con ese id o esa intensidad mínima"})
+		default:
+			writeKBError(w, err)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+func DeleteSeverity(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(apiError{Error: "método no permitido"})
+		return
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 3 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(apiError{Error: "ruta: /api/severities/{id}"})
+		return
+	}
+	err := KBApply(r.Context(), func(tx *KBTx) error {
+		cur, found := findSeverity(tx, parts[2])
+		if !found {
+			return errKBNotFound
+		}
+		_, err := tx.Retract(predSeverity, cur.Args...)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, errKBNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(apiError{Error: "no existe el nivel de severidad"})
+			return
+		}
+		writeKBError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
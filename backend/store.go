@@ -0,0 +1,309 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+type ArgType int
+
+const (
+	ArgAtom ArgType = iota
+	ArgNumber
+)
+
+// PredSchema describe un predicado administrado como hechos: nombre y tipo
+// de cada argumento.
+type PredSchema struct {
+	Name  string
+	Types []ArgType
+}
+
+func (s PredSchema) Arity() int { return len(s.Types) }
+
+func (s PredSchema) Indicator() string { return fmt.Sprintf("%s/%d", s.Name, len(s.Types)) }
+
+// Fact es un hecho con sus argumentos ya normalizados (átomos o números en
+// sintaxis Prolog).
+type Fact struct {
+	Pred string   `json:"pred"`
+	Args []string `json:"args"`
+}
+
+func (f Fact) Key() string { return f.Pred + "(" + strings.Join(f.Args, ",") + ")" }
+
+// Clause escribe el hecho como cláusula, con comillas en los átomos que las
+// necesitan.
+func (f Fact) Clause() string {
+	args := make([]string, len(f.Args))
+	for i, a := range f.Args {
+		args[i] = plAtom(a)
+	}
+	return f.Pred + "(" + strings.Join(args, ",") + ")."
+}
+
+func (f Fact) Indicator() string { return fmt.Sprintf("%s/%d", f.Pred, len(f.Args)) }
+
+// FactStore persiste los hechos de la base de conocimiento. El motor guarda
+// su propia copia en memoria: al almacén solo le pide cargar un predicado,
+// las reglas que no son hechos administrados y confirmar lotes de cambios.
+type FactStore interface {
+	Load(schema PredSchema) ([]Fact, error)
+	Rules(managed func(pred string, arity int) bool) []string
+	Begin() FactTx
+}
+
+// FactTx acumula cambios que se aplican todos juntos en Commit o ninguno.
+// Prepare deja los cambios escritos aparte (un archivo temporal) sin tocar
+// lo que el almacén ya tiene; así el motor puede preparar varios almacenes y
+// recién entonces confirmarlos todos. Commit sin Prepare previo hace las dos
+// cosas.
+type FactTx interface {
+	Assert(f Fact)
+	Retract(f Fact)
+	Prepare() error
+	Commit() error
+	Rollback()
+}
+
+var errTxClosed = errors.New("transacción ya cerrada")
+
+type factOp struct {
+	Fact   Fact
+	Assert bool
+}
+
+// stagedWrite es lo que deja Prepare: el archivo temporal que Commit
+// renombra sobre el definitivo (vacío si el almacén no escribe a disco) y
+// la instalación del nuevo estado en memoria.
+type stagedWrite struct {
+	tmp, file string
+	install   func()
+}
+
+type opTx struct {
+	ops      []factOp
+	prepare  func([]factOp) (stagedWrite, error)
+	staged   *stagedWrite
+	prepared bool
+	closed   bool
+}
+
+func (t *opTx) Assert(f Fact)  { t.ops = append(t.ops, factOp{Fact: f, Assert: true}) }
+func (t *opTx) Retract(f Fact) { t.ops = append(t.ops, factOp{Fact: f}) }
+
+func (t *opTx) Prepare() error {
+	if t.closed {
+		return errTxClosed
+	}
+	if t.prepared {
+		return nil
+	}
+	t.prepared = true
+	if len(t.ops) == 0 {
+		return nil
+	}
+	st, err := t.prepare(t.ops)
+	if err != nil {
+		t.closed = true
+		return err
+	}
+	t.staged = &st
+	return nil
+}
+
+func (t *opTx) Commit() error {
+	if err := t.Prepare(); err != nil {
+		return err
+	}
+	t.closed = true
+	if t.staged == nil {
+		return nil
+	}
+	if t.staged.tmp != "" {
+		if err := os.Rename(t.staged.tmp, t.staged.file); err != nil {
+			os.Remove(t.staged.tmp)
+			return err
+		}
+	}
+	t.staged.install()
+	return nil
+}
+
+func (t *opTx) Rollback() {
+	if !t.closed && t.staged != nil && t.staged.tmp != "" {
+		os.Remove(t.staged.tmp)
+	}
+	t.closed = true
+	t.ops = nil
+	t.staged = nil
+}
+
+// kbOpenStore elige el almacén según KB_STORE: "pl" (por defecto, el propio
+// archivo .pl), "json" (archivo embebido junto al .pl, o KB_JSON) o "memory"
+// (no persiste; útil para pruebas). Los dos últimos toman el .pl como semilla
+// y siguen leyendo de él las reglas.
+func kbOpenStore(file string) (FactStore, error) {
+	switch kind := strings.ToLower(strings.TrimSpace(os.Getenv("KB_STORE"))); kind {
+	case "", "pl":
+		return newPLFileStore(file), nil
+	case "json":
+		path := os.Getenv("KB_JSON")
+		if path == "" {
+			path = strings.TrimSuffix(file, filepath.Ext(file)) + ".kb.json"
+		}
+		return newJSONStore(path, file)
+	case "memory":
+		return newMemStore(file), nil
+	default:
+		return nil, fmt.Errorf("KB_STORE desconocido: %q", kind)
+	}
+}
+
+// factTable es la representación común de los almacenes que no son .pl.
+type factTable map[string][][]string // "pred/aridad" -> argumentos
+
+func (t factTable) clone() factTable {
+	out := make(factTable, len(t))
+	for k, rows := range t {
+		out[k] = append([][]string(nil), rows...)
+	}
+	return out
+}
+
+func (t factTable) apply(ops []factOp) {
+	for _, op := range ops {
+		ind := op.Fact.Indicator()
+		key := op.Fact.Key()
+		rows := t[ind]
+		idx := -1
+		for i, args := range rows {
+			if (Fact{Pred: op.Fact.Pred, Args: args}).Key() == key {
+				idx = i
+				break
+			}
+		}
+		switch {
+		case op.Assert && idx < 0:
+			t[ind] = append(rows, append([]string(nil), op.Fact.Args...))
+		case !op.Assert && idx >= 0:
+			t[ind] = append(rows[:idx:idx], rows[idx+1:]...)
+		}
+	}
+}
+
+func (t factTable) load(schema PredSchema) []Fact {
+	rows := t[schema.Indicator()]
+	out := make([]Fact, 0, len(rows))
+	for _, args := range rows {
+		out = append(out, Fact{Pred: schema.Name, Args: append([]string(nil), args...)})
+	}
+	return out
+}
+
+func factTableFromDoc(d *plDoc) factTable {
+	t := factTable{}
+	for _, c := range d.Clauses {
+		if !c.Fact || c.Arity == 0 {
+			continue
+		}
+		args := make([]string, c.Arity)
+		for i, a := range c.Args {
+			args[i] = plNormArg(a)
+		}
+		t.apply([]factOp{{Fact: Fact{Pred: c.Pred, Args: args}, Assert: true}})
+	}
+	return t
+}
+
+// docRules devuelve el texto de las cláusulas que no son hechos administrados.
+func docRules(d *plDoc, managed func(pred string, arity int) bool) []string {
+	var out []string
+	for _, c := range d.Clauses {
+		if c.Fact && managed(c.Pred, c.Arity) {
+			continue
+		}
+		out = append(out, c.Text)
+	}
+	return out
+}
+
+func writeFileAtomic(file string, data []byte) error {
+	tmp, err := writeTempFile(file, data)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// writeTempFile escribe data en un temporal junto a file, listo para
+// renombrarlo encima.
+func writeTempFile(file string, data []byte) (string, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file)+"-*.tmp")
+	if err != nil {
+		return "", err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := os.Chmod(tmp.Name(), fs.FileMode(0644)); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+// memStore mantiene los hechos solo en memoria, partiendo del .pl semilla.
+type memStore struct {
+	mu    sync.Mutex
+	seed  *plDoc
+	table factTable
+}
+
+func newMemStore(seedFile string) *memStore {
+	seed, err := plReadDoc(seedFile)
+	if err != nil {
+		seed = &plDoc{}
+	}
+	return &memStore{seed: seed, table: factTableFromDoc(seed)}
+}
+
+func (s *memStore) Load(schema PredSchema) ([]Fact, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.table.load(schema), nil
+}
+
+func (s *memStore) Rules(managed func(pred string, arity int) bool) []string {
+	return docRules(s.seed, managed)
+}
+
+func (s *memStore) Begin() FactTx {
+	return &opTx{prepare: func(ops []factOp) (stagedWrite, error) {
+		return stagedWrite{install: func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.table.apply(ops)
+		}}, nil
+	}}
+}
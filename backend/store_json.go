@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"sort"
+	"sync"
+)
+
+// jsonStore guarda todos los hechos en un único archivo JSON que se reemplaza
+// de forma atómica en cada commit. Las reglas se siguen leyendo del .pl.
+type jsonStore struct {
+	mu    sync.Mutex
+	file  string
+	seed  *plDoc
+	table factTable
+}
+
+type jsonStoreFile struct {
+	Facts factTable `json:"facts"`
+}
+
+func newJSONStore(file, seedFile string) (*jsonStore, error) {
+	seed, err := plReadDoc(seedFile)
+	if err != nil {
+		seed = &plDoc{}
+	}
+	s := &jsonStore{file: file, seed: seed}
+	src, err := os.ReadFile(file)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		s.table = factTableFromDoc(seed)
+		if err := s.write(s.table); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	default:
+		var f jsonStoreFile
+		if err := json.Unmarshal(src, &f); err != nil {
+			return nil, err
+		}
+		s.table = f.Facts
+		if s.table == nil {
+			s.table = factTable{}
+		}
+	}
+	return s, nil
+}
+
+func (s *jsonStore) write(t factTable) error {
+	data, err := s.encode(t)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.file, data)
+}
+
+func (s *jsonStore) encode(t factTable) ([]byte, error) {
+	sorted := t.clone()
+	for _, rows := range sorted {
+		sort.Slice(rows, func(i, j int) bool {
+			return (Fact{Args: rows[i]}).Key() < (Fact{Args: rows[j]}).Key()
+		})
+	}
+	return json.MarshalIndent(jsonStoreFile{Facts: sorted}, "", "  ")
+}
+
+func (s *jsonStore) Load(schema PredSchema) ([]Fact, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.table.load(schema), nil
+}
+
+func (s *jsonStore) Rules(managed func(pred string, arity int) bool) []string {
+	return docRules(s.seed, managed)
+}
+
+func (s *jsonStore) Begin() FactTx {
+	return &opTx{prepare: func(ops []factOp) (stagedWrite, error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		next := s.table.clone()
+		next.apply(ops)
+		data, err := s.encode(next)
+		if err != nil {
+			return stagedWrite{}, err
+		}
+		tmp, err := writeTempFile(s.file, data)
+		if err != nil {
+			return stagedWrite{}, err
+		}
+		return stagedWrite{tmp: tmp, file: s.file, install: func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.table = next
+		}}, nil
+	}}
+}
@@ -0,0 +1,84 @@
+package main
+
+import "sync"
+
+// plFileStore persiste los hechos en el propio archivo .pl, editando solo
+// las cláusulas afectadas y dejando reglas y comentarios intactos.
+type plFileStore struct {
+	mu   sync.Mutex
+	file string
+	doc  *plDoc
+}
+
+func newPLFileStore(file string) *plFileStore {
+	doc, err := plReadDoc(file)
+	if err != nil {
+		doc = &plDoc{}
+	}
+	return &plFileStore{file: file, doc: doc}
+}
+
+func (s *plFileStore) Load(schema PredSchema) ([]Fact, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// se devuelve el texto tal cual: KBRegister lo normaliza según el tipo
+	// de cada argumento
+	var out []Fact
+	for _, c := range s.doc.Clauses {
+		if c.Fact && c.Pred == schema.Name && c.Arity == schema.Arity() {
+			out = append(out, Fact{Pred: schema.Name, Args: append([]string(nil), c.Args...)})
+		}
+	}
+	return out, nil
+}
+
+func (s *plFileStore) Rules(managed func(pred string, arity int) bool) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return docRules(s.doc, managed)
+}
+
+func (s *plFileStore) Begin() FactTx {
+	return &opTx{prepare: s.prepare}
+}
+
+// prepare arma el nuevo documento a partir del actual; las escrituras del
+// motor van serializadas por kbWriteMu, así que nadie lo cambia entre
+// Prepare y Commit.
+func (s *plFileStore) prepare(ops []factOp) (stagedWrite, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	type predKey struct {
+		pred  string
+		arity int
+	}
+	var order []predKey
+	byPred := map[predKey][]factOp{}
+	for _, op := range ops {
+		k := predKey{op.Fact.Pred, len(op.Fact.Args)}
+		if _, ok := byPred[k]; !ok {
+			order = append(order, k)
+		}
+		byPred[k] = append(byPred[k], op)
+	}
+
+	next := &plDoc{Clauses: append([]plClause(nil), s.doc.Clauses...), Tail: s.doc.Tail}
+	for _, k := range order {
+		t := factTable{}
+		for _, args := range next.facts(k.pred, k.arity) {
+			t.apply([]factOp{{Fact: Fact{Pred: k.pred, Args: args}, Assert: true}})
+		}
+		t.apply(byPred[k])
+		next.replaceFacts(k.pred, k.arity, t[Fact{Pred: k.pred, Args: make([]string, k.arity)}.Indicator()])
+	}
+	tmp, err := writeTempFile(s.file, []byte(next.String()))
+	if err != nil {
+		return stagedWrite{}, err
+	}
+	return stagedWrite{tmp: tmp, file: s.file, install: func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.doc = next
+	}}, nil
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strings"
 )
@@ -17,6 +18,40 @@ type apiError struct {
 	Error string `json:"error"`
 }
 
+type apiRefError struct {
+	Error      string   `json:"error"`
+	Missing    []string `json:"missing,omitempty"`
+	Dependents []string `json:"dependents,omitempty"`
+}
+
+// writeKBError responde los errores del motor que no tienen un mensaje propio
+// en el handler.
+func writeKBError(w http.ResponseWriter, err error) {
+	var refErr *KBRefError
+	if errors.As(err, &refErr) {
+		if len(refErr.Missing) > 0 {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+		} else {
+			w.WriteHeader(http.StatusConflict)
+		}
+		json.NewEncoder(w).Encode(apiRefError{Error: refErr.Error(), Missing: refErr.Missing, Dependents: refErr.Dependents})
+		return
+	}
+	if errors.Is(err, errKBUnlogged) {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(apiError{Error: errKBUnlogged.Error()})
+		return
+	}
+	switch kbWhy(err) {
+	case "bad_number":
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(apiError{Error: err.Error()})
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(apiError{Error: "no se pudo guardar la base de conocimiento"})
+	}
+}
+
 func InitSymptoms() error {
 	return PLRegisterPredicate(predSymptoms, fileSymptoms)
 }
@@ -46,10 +81,14 @@ func createSymptom(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(apiError{Error: "JSON inválido. Envía {\"id\":\"...\"}"})
 		return
 	}
-	id, ok := PLCreate(predSymptoms, body.ID)
-	if !ok {
-		w.WriteHeader(http.StatusConflict)
-		json.NewEncoder(w).Encode(apiError{Error: "El síntoma ya existe"})
+	id, err := PLCreate(r.Context(), predSymptoms, body.ID)
+	if err != nil {
+		if errors.Is(err, errKBExists) {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(apiError{Error: "El síntoma ya existe"})
+			return
+		}
+		writeKBError(w, err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -69,9 +108,13 @@ func deleteSymptom(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	id := parts[2]
-	if !PLDelete(predSymptoms, id) {
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(apiError{Error: "No existe el síntoma"})
+	if _, err := KBDelete(r.Context(), predSymptoms, id); err != nil {
+		if errors.Is(err, errKBNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(apiError{Error: "No existe el síntoma"})
+			return
+		}
+		writeKBError(w, err)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
@@ -95,9 +138,9 @@ func updateSymptom(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(apiError{Error: "JSON inválido. Envía {\"id\":\"nuevo_id\"}"})
 		return
 	}
-	newID, ok, why := PLUpdate(predSymptoms, oldID, body.ID)
-	if !ok {
-		switch why {
+	f, err := KBUpdate(r.Context(), predSymptoms, []string{oldID}, []string{body.ID})
+	if err != nil {
+		switch kbWhy(err) {
 		case "not_found":
 			w.WriteHeader(http.StatusNotFound)
 			json.NewEncoder(w).Encode(apiError{Error: "No existe el síntoma a actualizar"})
@@ -105,10 +148,10 @@ func updateSymptom(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusConflict)
 			json.NewEncoder(w).Encode(apiError{Error: "Ya existe un síntoma con ese id"})
 		default:
-			http.Error(w, "Error", http.StatusInternalServerError)
+			writeKBError(w, err)
 		}
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(symptomDTO{ID: newID})
+	json.NewEncoder(w).Encode(symptomDTO{ID: f.Args[0]})
 }
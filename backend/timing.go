@@ -0,0 +1,82 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+const (
+	predDuration = "duracion_tipica"
+	predOnset    = "inicio_tipico"
+	fileTiming   = "prolog.pl"
+)
+
+// duracion_tipica(Enf, Sint, MinDias, MaxDias) e inicio_tipico(Enf, Sint,
+// subito|gradual) describen cómo suele presentarse el síntoma en la
+// enfermedad; factor_temporal/2 en prolog.pl dice cuánto premia o castiga
+// el encaje.
+var (
+	schemaDuration = []ArgType{ArgAtom, ArgAtom, ArgNumber, ArgNumber}
+	schemaOnset    = []ArgType{ArgAtom, ArgAtom, ArgAtom}
+)
+
+// DxTimeFit explica el ajuste temporal de una contribución.
+type DxTimeFit struct {
+	Aspect   string  `json:"aspect"`
+	Fit      string  `json:"fit"`
+	Expected string  `json:"expected"`
+	Factor   float64 `json:"factor"`
+}
+
+func InitTiming() error {
+	if err := KBRegister(PredSchema{Name: predDuration, Types: schemaDuration}, fileTiming); err != nil {
+		return err
+	}
+	return KBRegister(PredSchema{Name: predOnset, Types: schemaOnset}, fileTiming)
+}
+
+// normalizeOnset acepta subito/súbito y gradual; "" es desconocido. ok es
+// false para cualquier otro valor.
+func normalizeOnset(v string) (string, bool) {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "":
+		return "desconocido", true
+	case "subito", "súbito", "sudden":
+		return "subito", true
+	case "gradual":
+		return "gradual", true
+	}
+	return "", false
+}
+
+func durationTerm(d *float64) string {
+	if d == nil || *d < 0 {
+		return "desconocido"
+	}
+	return strconv.FormatFloat(*d, 'f', -1, 64)
+}
+
+// timeFits devuelve, por síntoma, el detalle de detalle_duracion/7 y
+// detalle_inicio/6 para la enfermedad.
+func timeFits(kb kbView, eID, syms string) map[string][]DxTimeFit {
+	out := map[string][]DxTimeFit{}
+	for _, s := range kb.ProveAll("member(s(S,_,_,Dias)," + syms + "), detalle_duracion(" + plAtom(eID) + ",S,Dias,Min,Max,E,F).") {
+		sid := plAtomOf(s.ByName_("S"))
+		out[sid] = append(out[sid], DxTimeFit{
+			Aspect:   "duracion",
+			Fit:      strings.TrimPrefix(plAtomOf(s.ByName_("E")), "duracion_"),
+			Expected: trimFloat(plNumberOf(s.ByName_("Min"))) + "-" + trimFloat(plNumberOf(s.ByName_("Max"))) + " dias",
+			Factor:   plNumberOf(s.ByName_("F")),
+		})
+	}
+	for _, s := range kb.ProveAll("member(s(S,_,Ini,_)," + syms + "), detalle_inicio(" + plAtom(eID) + ",S,Ini,T,E,F).") {
+		sid := plAtomOf(s.ByName_("S"))
+		out[sid] = append(out[sid], DxTimeFit{
+			Aspect:   "inicio",
+			Fit:      strings.TrimPrefix(plAtomOf(s.ByName_("E")), "inicio_"),
+			Expected: plAtomOf(s.ByName_("T")),
+			Factor:   plNumberOf(s.ByName_("F")),
+		})
+	}
+	return out
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	predTrata      = "trata"
+	predTreatPrio  = "prioridad_tratamiento"
+	fileTreatments = "prolog.pl"
+)
+
+type TreatmentIn struct {
+	DiseaseID    string `json:"diseaseId"`
+	MedicationID string `json:"medicationId"`
+	Priority     *int   `json:"priority,omitempty"`
+}
+
+type TreatmentOut struct {
+	DiseaseID    string `json:"diseaseId"`
+	MedicationID string `json:"medicationId"`
+	Priority     int    `json:"priority"`
+}
+
+// defaultTreatmentPriority se usa para los trata/2 sin prioridad explícita;
+// coincide con prioridad/3 en prolog.pl.
+const defaultTreatmentPriority = 100
+
+func InitTreatments() error {
+	if err := Register2(predTrata, fileTreatments); err != nil {
+		return err
+	}
+	return KBRegister(PredSchema{Name: predTreatPrio, Types: schema3}, fileTreatments)
+}
+
+// readTreatments arma la lista ordenada por enfermedad y prioridad.
+func readTreatments(trata, prio []Fact) []TreatmentOut {
+	p := map[[2]string]int{}
+	for _, f := range prio {
+		v, _ := strconv.ParseFloat(f.Args[2], 64)
+		p[[2]string{f.Args[0], f.Args[1]}] = int(v)
+	}
+	out := make([]TreatmentOut, 0, len(trata))
+	for _, f := range trata {
+		pr, ok := p[[2]string{f.Args[0], f.Args[1]}]
+		if !ok {
+			pr = defaultTreatmentPriority
+		}
+		out = append(out, TreatmentOut{DiseaseID: f.Args[0], MedicationID: f.Args[1], Priority: pr})
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].DiseaseID != out[j].DiseaseID {
+			return out[i].DiseaseID < out[j].DiseaseID
+		}
+		if out[i].Priority != out[j].Priority {
+			return out[i].Priority < out[j].Priority
+		}
+		return out[i].MedicationID < out[j].MedicationID
+	})
+	return out
+}
+
+func findTreatment(tx *KBTx, diseaseID, medID string) (TreatmentOut, bool) {
+	diseaseID, medID = toAtom(diseaseID), toAtom(medID)
+	for _, t := range readTreatments(tx.Facts(predTrata), tx.Facts(predTreatPrio)) {
+		if t.DiseaseID == diseaseID && t.MedicationID == medID {
+			return t, true
+		}
+	}
+	return TreatmentOut{}, false
+}
+
+// nextTreatmentPriority devuelve la prioridad que sigue a la última de la
+// enfermedad, para que un tratamiento nuevo quede como siguiente línea. Los
+// trata/2 sin prioridad_tratamiento cuentan con la prioridad por omisión.
+func nextTreatmentPriority(tx *KBTx, diseaseID string) int {
+	next := 1
+	for _, t := range readTreatments(tx.Facts(predTrata), tx.Facts(predTreatPrio)) {
+		if t.DiseaseID == toAtom(diseaseID) && t.Priority >= next {
+			next = t.Priority + 1
+		}
+	}
+	return next
+}
+
+func retractTreatment(tx *KBTx, t TreatmentOut) error {
+	if _, err := tx.Retract(predTrata, t.DiseaseID, t.MedicationID); err != nil {
+		return err
+	}
+	for _, f := range tx.Facts(predTreatPrio) {
+		if f.Args[0] == t.DiseaseID && f.Args[1] == t.MedicationID {
+			if _, err := tx.Retract(predTreatPrio, f.Args...); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func assertTreatment(tx *KBTx, diseaseID, medID string, priority int) (TreatmentOut, error) {
+	f, err := tx.Assert(predTrata, diseaseID, medID)
+	if err != nil {
+		return TreatmentOut{}, err
+	}
+	if _, err := tx.Assert(predTreatPrio, f.Args[0], f.Args[1], strconv.Itoa(priority)); err != nil {
+		return TreatmentOut{}, err
+	}
+	return TreatmentOut{DiseaseID: f.Args[0], MedicationID: f.Args[1], Priority: priority}, nil
+}
+
+// updateTreatment cambia trata/2 y su prioridad_tratamiento/3 con Update, así
+// la auditoría registra una modificación y no una baja y un alta.
+func updateTreatment(tx *KBTx, cur, next TreatmentOut) (TreatmentOut, error) {
+	f, err := tx.Update(predTrata, []string{cur.DiseaseID, cur.MedicationID}, []string{next.DiseaseID, next.MedicationID})
+	if err != nil {
+		return TreatmentOut{}, err
+	}
+	prio := strconv.Itoa(next.Priority)
+	updated := false
+	for _, p := range tx.Facts(predTreatPrio) {
+		if p.Args[0] != cur.DiseaseID || p.Args[1] != cur.MedicationID {
+			continue
+		}
+		if updated {
+			if _, err := tx.Retract(predTreatPrio, p.Args...); err != nil {
+				return TreatmentOut{}, err
+			}
+			continue
+		}
+		if _, err := tx.Update(predTreatPrio, p.Args, []string{f.Args[0], f.Args[1], prio}); err != nil {
+			return TreatmentOut{}, err
+		}
+		updated = true
+	}
+	if !updated {
+		if _, err := tx.Assert(predTreatPrio, f.Args[0], f.Args[1], prio); err != nil {
+			return TreatmentOut{}, err
+		}
+	}
+	return TreatmentOut{DiseaseID: f.Args[0], MedicationID: f.Args[1], Priority: next.Priority}, nil
+}
+
+func treatmentPathIDs(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) != 4 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(apiError{Error: "ruta: /api/treatments/{diseaseId}/{medicationId}"})
+		return "", "", false
+	}
+	return parts[2], parts[3], true
+}
+
+func ListTreatments(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(apiError{Error: "método no permitido"})
+		return
+	}
+	disease := r.URL.Query().Get("disease")
+	med := r.URL.Query().Get("medication")
+	out := []TreatmentOut{}
+	for _, t := range readTreatments(KBList(predTrata), KBList(predTreatPrio)) {
+		if disease != "" && t.DiseaseID != toAtom(disease) {
+			continue
+		}
+		if med != "" && t.MedicationID != toAtom(med) {
+			continue
+		}
+		out = append(out, t)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+func CreateTreatment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(apiError{Error: "método no permitido"})
+		return
+	}
+	var in TreatmentIn
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(apiError{Error: "JSON inválido"})
+		return
+	}
+	if strings.TrimSpace(in.DiseaseID) == "" || strings.TrimSpace(in.MedicationID) == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(apiError{Error: "diseaseId y medicationId son obligatorios"})
+		return
+	}
+	var out TreatmentOut
+	err := KBApply(r.Context(), func(tx *KBTx) error {
+		priority := nextTreatmentPriority(tx, in.DiseaseID)
+		if in.Priority != nil {
+			priority = *in.Priority
+		}
+		var err error
+		out, err = assertTreatment(tx, in.DiseaseID, in.MedicationID, priority)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, errKBExists) {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(apiError{Error: "el tratamiento ya existe"})
+			return
+		}
+		writeKBError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(out)
+}
+
+func UpdateTreatment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut && r.Method != http.MethodPatch {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(apiError{Error: "método no permitido"})
+		return
+	}
+	oldDisease, oldMed, ok := treatmentPathIDs(w, r)
+	if !ok {
+		return
+	}
+	var in TreatmentIn
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(apiError{Error: "JSON inválido"})
+		return
+	}
+	var out TreatmentOut
+	err := KBApply(r.Context(), func(tx *KBTx) error {
+		cur, found := findTreatment(tx, oldDisease, oldMed)
+		if !found {
+			return errKBNotFound
+		}
+		next := TreatmentOut{DiseaseID: cur.DiseaseID, MedicationID: cur.MedicationID, Priority: cur.Priority}
+		if strings.TrimSpace(in.DiseaseID) != "" {
+			next.DiseaseID = in.DiseaseID
+		}
+		if strings.TrimSpace(in.MedicationID) != "" {
+			next.MedicationID = in.MedicationID
+		}
+		if in.Priority != nil {
+			next.Priority = *in.Priority
+		}
+		var err error
+		out, err = updateTreatment(tx, cur, next)
+		return err
+	})
+	if err != nil {
+		switch kbWhy(err) {
+		case "not_found":
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(apiError{Error: "no existe el tratamiento a actualizar"})
+		case "conflict":
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(apiError{Error: "ya existe ese tratamiento"})
+		default:
+			writeKBError(w, err)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+func DeleteTreatment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(apiError{Error: "método no permitido"})
+		return
+	}
+	disease, med, ok := treatmentPathIDs(w, r)
+	if !ok {
+		return
+	}
+	err := KBApply(r.Context(), func(tx *KBTx) error {
+		cur, found := findTreatment(tx, disease, med)
+		if !found {
+			return errKBNotFound
+		}
+		return retractTreatment(tx, cur)
+	})
+	if err != nil {
+		if errors.Is(err, errKBNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(apiError{Error: "no existe el tratamiento"})
+			return
+		}
+		writeKBError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
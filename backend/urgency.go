@@ -0,0 +1,54 @@
+package main
+
+import "strings"
+
+const (
+	predUrgencyBase = "urgencia_base"
+	predEscalation  = "escalada_urgencia"
+	fileUrgency     = "prolog.pl"
+)
+
+// urgencia_base(Enf, Urgencia) es el piso de urgencia de la enfermedad cuando
+// coincide con algún síntoma del paciente, y escalada_urgencia(Enf, Sint,
+// SeveridadMinima, Urgencia) la sube cuando el síntoma aparece con al menos
+// esa severidad. urgencia_enfermedad/6 en prolog.pl elige la más urgente
+// entre bandera roja, escalada, base y la regla genérica urgencia/2 sobre los
+// síntomas de la enfermedad.
+var schemaEscalation = []ArgType{ArgAtom, ArgAtom, ArgAtom, ArgAtom}
+
+func InitUrgency() error {
+	if err := Register2(predUrgencyBase, fileUrgency); err != nil {
+		return err
+	}
+	return KBRegister(PredSchema{Name: predEscalation, Types: schemaEscalation}, fileUrgency)
+}
+
+// diseaseUrgency devuelve la urgencia de la enfermedad y la regla que la
+// decidió.
+func diseaseUrgency(kb kbView, eID, syms, profile string) (string, DxRule) {
+	sols := kb.ProveAll("urgencia_enfermedad(" + plAtom(eID) + "," + syms + "," + profile + ",U,Regla,Det).")
+	if len(sols) == 0 {
+		return "posible_automanejo", DxRule{Rule: "urgencia/2", Details: eID + "->posible_automanejo"}
+	}
+	urg, rule, det := plAtomOf(sols[0].ByName_("U")), plAtomOf(sols[0].ByName_("Regla")), plAtomOf(sols[0].ByName_("Det"))
+	switch rule {
+	case "bandera_roja":
+		var flagSyms []string
+		for _, s := range kb.ProveAll("bandera_sintoma(" + plAtom(det) + ",S).") {
+			flagSyms = append(flagSyms, plAtomOf(s.ByName_("S")))
+		}
+		return urg, DxRule{Rule: "bandera_roja/4", Details: det + "," + strings.Join(flagSyms, "+") + "->" + urg}
+	case "escalada_urgencia":
+		return urg, DxRule{Rule: "escalada_urgencia/4", Details: eID + "," + det + "->" + urg}
+	case "urgencia_base":
+		return urg, DxRule{Rule: "urgencia_base/2", Details: eID + "->" + urg}
+	}
+	var sevs []string
+	for _, s := range kb.ProveAll("member(s(S,Sev,_,_)," + syms + "), enfermedad_sintoma(" + plAtom(eID) + ",S,_).") {
+		sevs = append(sevs, plAtomOf(s.ByName_("S"))+":"+plAtomOf(s.ByName_("Sev")))
+	}
+	if len(sevs) == 0 {
+		return urg, DxRule{Rule: "urgencia/2", Details: eID + "->" + urg}
+	}
+	return urg, DxRule{Rule: "urgencia/2", Details: eID + "," + strings.Join(sevs, ",") + "->" + urg}
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// kbVersion es la versión publicada; se escribe con kbWriteMu y plMutex
+// tomados, igual que kbFacts.
+var kbVersion int
+
+// KBSnapshot es el conjunto completo de hechos administrados tras una
+// transacción, guardado en {DATA_DIR}/versions/{version}.json.
+type KBSnapshot struct {
+	Version   int                   `json:"version"`
+	CreatedAt string                `json:"createdAt"`
+	Actor     string                `json:"actor"`
+	Note      string                `json:"note,omitempty"`
+	Facts     map[string][][]string `json:"facts,omitempty"`
+	FactCount int                   `json:"factCount"`
+}
+
+// KBPredDiff son los cambios de un predicado entre dos versiones. Changed
+// son las modificaciones que la auditoría registró como update.
+type KBPredDiff struct {
+	Added   [][]string    `json:"added"`
+	Removed [][]string    `json:"removed"`
+	Changed []KBFactDelta `json:"changed"`
+}
+
+type KBFactDelta struct {
+	Old []string `json:"old"`
+	New []string `json:"new"`
+}
+
+var errVersionNotFound = errors.New("no existe la versión")
+
+func versionsDir() string {
+	return filepath.Join(dataDir(), "versions")
+}
+
+func versionFile(v int) string {
+	return filepath.Join(versionsDir(), fmt.Sprintf("%06d.json", v))
+}
+
+// KBVersion devuelve la versión de la base con la que responden las consultas.
+func KBVersion() int {
+	plMutex.Lock()
+	defer plMutex.Unlock()
+	return kbVersion
+}
+
+func snapshotFacts(sets map[string]map[string]Fact) (map[string][][]string, int) {
+	out := map[string][][]string{}
+	n := 0
+	for _, pred := range sortedKeys(sets) {
+		rows := [][]string{}
+		for _, k := range sortedKeys(sets[pred]) {
+			rows = append(rows, sets[pred][k].Args)
+		}
+		out[pred] = rows
+		n += len(rows)
+	}
+	return out, n
+}
+
+func writeSnapshot(s KBSnapshot) error {
+	if err := os.MkdirAll(versionsDir(), 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(versionFile(s.Version), data)
+}
+
+func readSnapshot(v int) (KBSnapshot, error) {
+	data, err := os.ReadFile(versionFile(v))
+	if errors.Is(err, fs.ErrNotExist) {
+		return KBSnapshot{}, errVersionNotFound
+	}
+	if err != nil {
+		return KBSnapshot{}, err
+	}
+	var s KBSnapshot
+	err = json.Unmarshal(data, &s)
+	return s, err
+}
+
+// listVersions devuelve los números de versión guardados, de menor a mayor.
+func listVersions() ([]int, error) {
+	entries, err := os.ReadDir(versionsDir())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var out []int
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok {
+			continue
+		}
+		if v, err := strconv.Atoi(name); err == nil {
+			out = append(out, v)
+		}
+	}
+	sort.Ints(out)
+	return out, nil
+}
+
+// InitVersions retoma la última versión guardada. Si los hechos cargados no
+// coinciden con ella (por ejemplo, prolog.pl se editó a mano) o no hay
+// ninguna, guarda una versión nueva.
+func InitVersions() error {
+	kbWriteMu.Lock()
+	defer kbWriteMu.Unlock()
+	plMutex.Lock()
+	defer plMutex.Unlock()
+	vs, err := listVersions()
+	if err != nil {
+		return err
+	}
+	facts, n := snapshotFacts(kbFacts)
+	if len(vs) > 0 {
+		last, err := readSnapshot(vs[len(vs)-1])
+		if err != nil {
+			return err
+		}
+		kbVersion = last.Version
+		if sameFacts(last.Facts, facts) {
+			return nil
+		}
+	}
+	s := KBSnapshot{Version: kbVersion + 1, CreatedAt: time.Now().UTC().Format(time.RFC3339), Actor: "sistema", Note: "carga inicial", Facts: facts, FactCount: n}
+	if err := writeSnapshot(s); err != nil {
+		return err
+	}
+	kbVersion = s.Version
+	return nil
+}
+
+func sameFacts(a, b map[string][][]string) bool {
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	return string(ja) == string(jb)
+}
+
+// snapshot guarda la versión que deja la transacción. Se llama desde Commit
+// con kbWriteMu tomado, así que nadie más cambia kbVersion mientras tanto.
+func (tx *KBTx) snapshot() (int, error) {
+	sets := map[string]map[string]Fact{}
+	for pred, set := range kbFacts {
+		sets[pred] = set
+	}
+	for pred, set := range tx.work {
+		sets[pred] = set
+	}
+	facts, n := snapshotFacts(sets)
+	s := KBSnapshot{Version: kbVersion + 1, CreatedAt: time.Now().UTC().Format(time.RFC3339), Actor: tx.actor, Note: tx.note, Facts: facts, FactCount: n}
+	return s.Version, writeSnapshot(s)
+}
+
+// diffSnapshots compara dos versiones. Una baja y un alta solo se muestran
+// como modificación si la auditoría registró ese update entre ambas
+// versiones; la comparación de hechos por sí sola no lo adivina.
+func diffSnapshots(from, to KBSnapshot, audit []AuditEntry) map[string]KBPredDiff {
+	lo, hi := from.Version, to.Version
+	if lo > hi {
+		lo, hi = hi, lo
+	}
+	updates := map[string][]KBFactDelta{}
+	for _, e := range audit {
+		if e.Action != auditUpdate || e.KBVersion <= lo || e.KBVersion > hi {
+			continue
+		}
+		d := KBFactDelta{Old: e.Old, New: e.New}
+		if from.Version > to.Version {
+			d = KBFactDelta{Old: e.New, New: e.Old}
+		}
+		updates[e.Pred] = append(updates[e.Pred], d)
+	}
+
+	preds := map[string]bool{}
+	for p := range from.Facts {
+		preds[p] = true
+	}
+	for p := range to.Facts {
+		preds[p] = true
+	}
+	out := map[string]KBPredDiff{}
+	for _, pred := range sortedKeys(preds) {
+		before, after := factKeySet(from.Facts[pred]), factKeySet(to.Facts[pred])
+		removed, added := map[string][]string{}, map[string][]string{}
+		for k, r := range before {
+			if _, ok := after[k]; !ok {
+				removed[k] = r
+			}
+		}
+		for k, r := range after {
+			if _, ok := before[k]; !ok {
+				added[k] = r
+			}
+		}
+		if len(removed) == 0 && len(added) == 0 {
+			continue
+		}
+		d := KBPredDiff{Added: [][]string{}, Removed: [][]string{}, Changed: []KBFactDelta{}}
+		for _, u := range updates[pred] {
+			ko, kn := strings.Join(u.Old, "\x00"), strings.Join(u.New, "\x00")
+			if _, ok := removed[ko]; !ok {
+				continue
+			}
+			if _, ok := added[kn]; !ok {
+				continue
+			}
+			delete(removed, ko)
+			delete(added, kn)
+			d.Changed = append(d.Changed, u)
+		}
+		for _, k := range sortedKeys(removed) {
+			d.Removed = append(d.Removed, removed[k])
+		}
+		for _, k := range sortedKeys(added) {
+			d.Added = append(d.Added, added[k])
+		}
+		out[pred] = d
+	}
+	return out
+}
+
+func factKeySet(rows [][]string) map[string][]string {
+	out := make(map[string][]string, len(rows))
+	for _, r := range rows {
+		out[strings.Join(r, "\x00")] = r
+	}
+	return out
+}
+
+// rollbackTo deja los hechos como en la versión v dentro de una sola
+// transacción: se confirma todo o nada, la máquina se reconstruye una vez y
+// el resultado queda como una versión nueva. Los predicados que la versión
+// no guardó no se tocan.
+func rollbackTo(tx *KBTx, v int) error {
+	s, err := readSnapshot(v)
+	if err != nil {
+		return err
+	}
+	tx.note = "rollback a la versión " + strconv.Itoa(v)
+	for _, pred := range sortedKeys(s.Facts) {
+		if _, ok := kbSchemas[pred]; !ok {
+			continue
+		}
+		want := factKeySet(s.Facts[pred])
+		for _, f := range tx.Facts(pred) {
+			if _, ok := want[strings.Join(f.Args, "\x00")]; !ok {
+				if _, err := tx.Retract(pred, f.Args...); err != nil {
+					return err
+				}
+			}
+		}
+		for _, k := range sortedKeys(want) {
+			if !tx.Has(pred, want[k]...) {
+				if _, err := tx.Assert(pred, want[k]...); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func writeVersionError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errVersionNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(apiError{Error: err.Error()})
+		return
+	}
+	writeKBError(w, err)
+}
+
+func ListVersions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(apiError{Error: "método no permitido"})
+		return
+	}
+	vs, err := listVersions()
+	if err != nil {
+		writeKBError(w, err)
+		return
+	}
+	out := make([]KBSnapshot, 0, len(vs))
+	for i := len(vs) - 1; i >= 0; i-- {
+		s, err := readSnapshot(vs[i])
+		if err != nil {
+			writeKBError(w, err)
+			return
+		}
+		s.Facts = nil
+		out = append(out, s)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"current": KBVersion(), "versions": out})
+}
+
+// handleVersion atiende /api/kb/versions/{n} (GET), /api/kb/versions/{n}/rollback
+// (POST) y /api/kb/versions/diff?from=&to= (GET).
+func handleVersion(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 4 || len(parts) > 5 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(apiError{Error: "ruta: /api/kb/versions/{n}[/rollback] o /api/kb/versions/diff"})
+		return
+	}
+	if parts[3] == "diff" && len(parts) == 4 {
+		diffVersions(w, r)
+		return
+	}
+	v, err := strconv.Atoi(parts[3])
+	if err != nil || v < 1 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(apiError{Error: "la versión debe ser un entero positivo"})
+		return
+	}
+	switch {
+	case len(parts) == 4 && r.Method == http.MethodGet:
+		s, err := readSnapshot(v)
+		if err != nil {
+			writeVersionError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s)
+	case len(parts) == 5 && parts[4] == "rollback" && r.Method == http.MethodPost:
+		err := KBApply(r.Context(), func(tx *KBTx) error { return rollbackTo(tx, v) })
+		if err != nil {
+			writeVersionError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int{"restored": v, "current": KBVersion()})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(apiError{Error: "método no permitido"})
+	}
+}
+
+func diffVersions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(apiError{Error: "método no permitido"})
+		return
+	}
+	q := r.URL.Query()
+	from, err1 := strconv.Atoi(q.Get("from"))
+	to, err2 := strconv.Atoi(q.Get("to"))
+	if q.Get("to") == "" {
+		to, err2 = KBVersion(), nil
+	}
+	if err1 != nil || err2 != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(apiError{Error: "from y to deben ser números de versión (to por omisión es la actual)"})
+		return
+	}
+	a, err := readSnapshot(from)
+	if err != nil {
+		writeVersionError(w, err)
+		return
+	}
+	b, err := readSnapshot(to)
+	if err != nil {
+		writeVersionError(w, err)
+		return
+	}
+	auditMu.Lock()
+	audit, err := readAudit()
+	auditMu.Unlock()
+	if err != nil {
+		writeKBError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"from": from, "to": to, "predicates": diffSnapshots(a, b, audit)})
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// TestVersionDiffAndRollback crea una versión con un alta y una modificación,
+// compara en los dos sentidos y vuelve a la versión inicial.
+func TestVersionDiffAndRollback(t *testing.T) {
+	freshKB(t)
+	v1 := KBVersion()
+	err := KBApply(context.Background(), func(tx *KBTx) error {
+		if _, err := tx.Assert(predSymptoms, "prueba_v"); err != nil {
+			return err
+		}
+		_, err := tx.Update(predDisSym, []string{"gripe", "fiebre", "0.3"}, []string{"gripe", "fiebre", "0.5"})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2 := KBVersion()
+	if v2 != v1+1 {
+		t.Fatalf("versión %d tras confirmar desde %d", v2, v1)
+	}
+
+	audit, err := readAudit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		from, to int
+		want     map[string]KBPredDiff
+	}{
+		{
+			name: "hacia adelante",
+			from: v1, to: v2,
+			want: map[string]KBPredDiff{
+				predDisSym: {Added: [][]string{}, Removed: [][]string{}, Changed: []KBFactDelta{
+					{Old: []string{"gripe", "fiebre", "0.3"}, New: []string{"gripe", "fiebre", "0.5"}},
+				}},
+				predSymptoms: {Added: [][]string{{"prueba_v"}}, Removed: [][]string{}, Changed: []KBFactDelta{}},
+			},
+		},
+		{
+			name: "hacia atrás invierte la modificación",
+			from: v2, to: v1,
+			want: map[string]KBPredDiff{
+				predDisSym: {Added: [][]string{}, Removed: [][]string{}, Changed: []KBFactDelta{
+					{Old: []string{"gripe", "fiebre", "0.5"}, New: []string{"gripe", "fiebre", "0.3"}},
+				}},
+				predSymptoms: {Added: [][]string{}, Removed: [][]string{{"prueba_v"}}, Changed: []KBFactDelta{}},
+			},
+		},
+		{
+			name: "misma versión",
+			from: v2, to: v2,
+			want: map[string]KBPredDiff{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, err := readSnapshot(tt.from)
+			if err != nil {
+				t.Fatal(err)
+			}
+			to, err := readSnapshot(tt.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := diffSnapshots(from, to, audit); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diff = %+v, se esperaba %+v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("rollback", func(t *testing.T) {
+		err := KBApply(context.Background(), func(tx *KBTx) error { return rollbackTo(tx, v1) })
+		if err != nil {
+			t.Fatal(err)
+		}
+		if KBVersion() != v2+1 {
+			t.Errorf("el rollback dejó la versión %d, se esperaba %d", KBVersion(), v2+1)
+		}
+		before, err := readSnapshot(v1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		after, err := readSnapshot(KBVersion())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sameFacts(before.Facts, after.Facts) {
+			t.Error("los hechos no quedaron como en la versión inicial")
+		}
+		if kbHas(predSymptoms, "prueba_v") || !kbHas(predDisSym, "gripe", "fiebre", "0.3") {
+			t.Error("la base en memoria no volvió a la versión inicial")
+		}
+	})
+
+	t.Run("versión inexistente", func(t *testing.T) {
+		version := KBVersion()
+		err := KBApply(context.Background(), func(tx *KBTx) error { return rollbackTo(tx, 999) })
+		if !errors.Is(err, errVersionNotFound) {
+			t.Errorf("error = %v, se esperaba %v", err, errVersionNotFound)
+		}
+		if KBVersion() != version {
+			t.Errorf("la versión cambió a %d", KBVersion())
+		}
+	})
+}
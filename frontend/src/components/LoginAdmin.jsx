@@ -1,39 +1,15 @@
-import { useEffect, useState } from "react";
+import { useState } from "react";
 import { useNavigate } from "react-router-dom";
 import "./LoginAdmin.css";
 
+const API = "http://localhost:8000";
+
 export default function LoginAdmin() {
   const navigate = useNavigate();
   const [usuario, setUsuario] = useState("");
   const [contrasena, setContrasena] = useState("");
   const [error, setError] = useState(null);
   const [loading, setLoading] = useState(false);
-  const [admins, setAdmins] = useState([]);
-
-  useEffect(() => {
-    const loadAdmins = async () => {
-      try {
-        const res = await fetch("/admins.txt", { cache: "no-store" });
-        if (!res.ok) throw new Error("No se pudo cargar admins.txt");
-        const text = await res.text();
-        const parsed = text
-            .split("\n")
-            .map(l => l.trim())
-            .filter(l => l && !l.startsWith("#"))
-            .map(l => {
-              const parts = l.split(/\s*-\s*/);
-              const email = (parts[0] || "").trim().toLowerCase();
-              const password = (parts[1] || "").trim();
-              return { email, password };
-            })
-            .filter(a => a.email && a.password);
-        setAdmins(parsed);
-      } catch (e) {
-        setError("Error cargando configuración de administradores.");
-      }
-    };
-    loadAdmins();
-  }, []);
 
   const handleLogin = async (e) => {
     e.preventDefault();
@@ -46,15 +22,17 @@ export default function LoginAdmin() {
 
     setLoading(true);
     try {
-      const email = usuario.trim().toLowerCase();
-      const pass = contrasena;
-
-      const match = admins.find(a => a.email === email && a.password === pass);
+      const res = await fetch(`${API}/api/auth/login`, {
+        method: "POST",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify({ email: usuario.trim().toLowerCase(), password: contrasena }),
+      });
 
-      if (match) {
-        localStorage.setItem("access_token", "LOCAL_ADMIN_LOGIN");
-        localStorage.setItem("user_email", email);
-        localStorage.setItem("user_role", "admin");
+      if (res.ok) {
+        const session = await res.json();
+        localStorage.setItem("access_token", session.token);
+        localStorage.setItem("user_email", session.email);
+        localStorage.setItem("user_role", session.role);
         navigate("/admin/page");
       } else {
         setError("Credenciales inválidas o usuario no autorizado.");
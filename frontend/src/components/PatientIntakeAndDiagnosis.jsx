@@ -5,6 +5,12 @@ import html2canvas from "html2canvas";
 
 const API = "http://localhost:8000";
 
+// Cabecera de sesión si hay un token de /api/auth/login guardado.
+const authHeaders = () => {
+    const token = localStorage.getItem("access_token");
+    return token ? { Authorization: `Bearer ${token}` } : {};
+};
+
 const STYLE_TAG_ID = "patient-intake-styles";
 const BASE_CSS = `
 :root {
@@ -62,11 +68,36 @@ body{color:var(--txt)}
 
 `;
 
+// Los síntomas marcados con DENIED se envían en deniedSymptoms.
+const DENIED = "negado";
+
+// Niveles por defecto; se reemplazan con los de /api/severities al cargar.
 const SEVERITIES = [
     { value: "leve", label: "Leve" },
     { value: "moderado", label: "Moderado" },
     { value: "severo", label: "Severo" },
 ];
+const DENIED_OPTION = { value: DENIED, label: "No lo presenta" };
+
+// Solo envía los datos demográficos que el usuario completó.
+function demographicsBody(d) {
+    const out = {};
+    for (const k of ["ageYears", "weightKg", "creatinineClearance"]) {
+        if (d[k] !== "" && !isNaN(+d[k])) out[k] = +d[k];
+    }
+    if (d.sex) out.sex = d.sex;
+    if (d.pregnant) out.pregnant = true;
+    if (d.riskFactors.length) out.riskFactors = d.riskFactors;
+    return Object.keys(out).length ? out : undefined;
+}
+
+const EMPTY_DEMOGRAPHICS = { ageYears: "", weightKg: "", creatinineClearance: "", sex: "", pregnant: false, riskFactors: [] };
+
+const RISK_FACTORS = [
+    { value: "fumador", label: "Fumador" },
+    { value: "inmunocomprometido", label: "Inmunocomprometido" },
+    { value: "viaje_reciente", label: "Viaje reciente" },
+];
 
 export default function PatientIntakeAndDiagnosis() {
     useEffect(() => {
@@ -84,16 +115,25 @@ export default function PatientIntakeAndDiagnosis() {
     const [symptoms, setSymptoms] = useState([]);
     const [medications, setMedications] = useState([]);
     const [chronicConditions, setChronicConditions] = useState([]);
+    const [severities, setSeverities] = useState(SEVERITIES);
+    const [patients, setPatients] = useState([]);
+    const [patientId, setPatientId] = useState("");
+    const [provenance, setProvenance] = useState(null);
 
     const [selectedSymptoms, setSelectedSymptoms] = useState({});
+    const [symptomTiming, setSymptomTiming] = useState({});
     const [selectedAllergies, setSelectedAllergies] = useState([]);
     const [selectedChronics, setSelectedChronics] = useState([]);
+    const [selectedCurrentMeds, setSelectedCurrentMeds] = useState([]);
+    const [demographics, setDemographics] = useState(EMPTY_DEMOGRAPHICS);
 
     const [loading, setLoading] = useState(false);
     const [error, setError] = useState(null);
     const [results, setResults] = useState([]);
     const [generatedAt, setGeneratedAt] = useState(null);
     const [rulesGlobal, setRulesGlobal] = useState("");
+    const [confidence, setConfidence] = useState(null);
+    const [followUp, setFollowUp] = useState([]);
 
     const HISTORY_KEY = "DIAG_HISTORY";
     const [history, setHistory] = useState([]);
@@ -118,13 +158,21 @@ export default function PatientIntakeAndDiagnosis() {
         const loadAll = async () => {
             setError(null);
             try {
-                const [s, m, c] = await Promise.all([
+                const [s, m, c, sv] = await Promise.all([
                     fetch(`${API}/api/symptoms`, { cache: "no-store" }),
                     fetch(`${API}/api/medications`, { cache: "no-store" }),
                     fetch(`${API}/api/chronics`, { cache: "no-store" }),
+                    fetch(`${API}/api/severities`, { cache: "no-store" }),
                 ]);
 
-                const [symData, medData, chrData] = await Promise.all([safeJson(s), safeJson(m), safeJson(c)]);
+                const [symData, medData, chrData, sevData] = await Promise.all([safeJson(s), safeJson(m), safeJson(c), safeJson(sv)]);
+                fetch(`${API}/api/patients`, { cache: "no-store", headers: authHeaders() })
+                    .then(safeJson)
+                    .then((p) => Array.isArray(p) && setPatients(p))
+                    .catch(() => {});
+                if (Array.isArray(sevData) && sevData.length) {
+                    setSeverities(sevData.map((l) => ({ value: l.id, label: prettify(l.id) })));
+                }
 
                 const symNorm = Array.isArray(symData)
                     ? symData.map((s) => ({
@@ -173,15 +221,37 @@ export default function PatientIntakeAndDiagnosis() {
         setSelectedSymptoms((prev) => {
             const next = { ...prev };
             if (next[id]) delete next[id];
-            else next[id] = "leve";
+            else next[id] = severities[0]?.value || "leve";
             return next;
         });
     };
     const changeSeverity = (id, severity) => setSelectedSymptoms((p) => ({ ...p, [id]: severity }));
+    // Responder una pregunta de seguimiento marca el síntoma y la quita de la lista.
+    const answerFollowUp = (id, present) => {
+        changeSeverity(id, present ? severities[0]?.value || "leve" : DENIED);
+        setFollowUp((q) => q.filter((x) => x.symptomId !== id));
+    };
+    const changeTiming = (id, field, value) => setSymptomTiming((p) => ({ ...p, [id]: { ...p[id], [field]: value } }));
+    const symptomBody = (s) => {
+        const t = symptomTiming[s.id] || {};
+        const out = { id: isNaN(+s.id) ? s.id : +s.id, severity: s.severity };
+        // con intensidad el backend deduce la severidad de su banda
+        if (t.intensity !== undefined && t.intensity !== "" && !isNaN(+t.intensity)) {
+            out.intensity = +t.intensity;
+            delete out.severity;
+        }
+        if (t.onset) out.onset = t.onset;
+        if (t.durationDays !== undefined && t.durationDays !== "" && !isNaN(+t.durationDays)) out.durationDays = +t.durationDays;
+        return out;
+    };
     const toggleFromList = (value, list, setter) => setter(list.includes(value) ? list.filter((v) => v !== value) : [...list, value]);
 
     const selectedSymptomArray = useMemo(
-        () => Object.entries(selectedSymptoms).map(([id, severity]) => ({ id, severity })),
+        () => Object.entries(selectedSymptoms).filter(([, severity]) => severity !== DENIED).map(([id, severity]) => ({ id, severity })),
+        [selectedSymptoms]
+    );
+    const deniedSymptoms = useMemo(
+        () => Object.entries(selectedSymptoms).filter(([, severity]) => severity === DENIED).map(([id]) => id),
         [selectedSymptoms]
     );
     const canAnalyze = selectedSymptomArray.length > 0 && !loading;
@@ -195,17 +265,19 @@ export default function PatientIntakeAndDiagnosis() {
         setLoading(true);
         try {
             const body = {
-                symptoms: selectedSymptomArray.map((s) => ({
-                    id: isNaN(+s.id) ? s.id : +s.id,
-                    severity: s.severity,
-                })),
+                symptoms: selectedSymptomArray.map(symptomBody),
+                deniedSymptoms,
                 allergies: selectedAllergies.map((id) => (isNaN(+id) ? id : +id)),
                 chronics: selectedChronics.map((id) => (isNaN(+id) ? id : +id)),
+                currentMedications: selectedCurrentMeds,
+                demographics: demographicsBody(demographics),
+                differentialOnly: true,
             };
+            if (patientId) body.patientId = patientId;
 
             const res = await fetch(`${API}/api/diagnosis`, {
                 method: "POST",
-                headers: { "Content-Type": "application/json" },
+                headers: { "Content-Type": "application/json", ...authHeaders() },
                 body: JSON.stringify(body),
             });
             const data = await safeJson(res);
@@ -215,6 +287,9 @@ export default function PatientIntakeAndDiagnosis() {
             setResults(sorted);
             setGeneratedAt(data.generatedAt || new Date().toISOString());
             setRulesGlobal(data.rulesGlobal || "");
+            setConfidence({ gap: data.confidenceGap, ambiguous: !!data.ambiguous, total: data.totalCandidates, kbVersion: data.kbVersion });
+            setFollowUp(data.followUpQuestions || []);
+            setProvenance(data.provenance || null);
 
             const entry = {
                 ts: new Date().toISOString(),
@@ -264,17 +339,19 @@ export default function PatientIntakeAndDiagnosis() {
 
     const downloadPDFServer = async () => {
         const body = {
-            symptoms: Object.entries(selectedSymptoms).map(([id, severity]) => ({
-                id: isNaN(+id) ? id : +id,
-                severity,
-            })),
+            symptoms: selectedSymptomArray.map(symptomBody),
+            deniedSymptoms,
             allergies: selectedAllergies.map((id) => (isNaN(+id) ? id : +id)),
             chronics: selectedChronics.map((id) => (isNaN(+id) ? id : +id)),
+            currentMedications: selectedCurrentMeds,
+            demographics: demographicsBody(demographics),
+            differentialOnly: true,
         };
+        if (patientId) body.patientId = patientId;
         try {
             const res = await fetch(`${API}/api/diagnosis/pdf`, {
                 method: "POST",
-                headers: { "Content-Type": "application/json" },
+                headers: { "Content-Type": "application/json", ...authHeaders() },
                 body: JSON.stringify(body),
             });
             if (!res.ok) throw new Error();
@@ -330,7 +407,7 @@ export default function PatientIntakeAndDiagnosis() {
                                                         onChange={(e) => changeSeverity(s.id, e.target.value)}
                                                         className="pi-select"
                                                     >
-                                                        {SEVERITIES.map((sv) => (
+                                                        {[...severities, DENIED_OPTION].map((sv) => (
                                                             <option key={sv.value} value={sv.value}>
                                                                 {sv.label}
                                                             </option>
@@ -338,6 +415,39 @@ export default function PatientIntakeAndDiagnosis() {
                                                     </select>
                                                 </div>
                                             )}
+                                            {checked && selectedSymptoms[s.id] !== DENIED && (
+                                                <div className="pi-row">
+                                                    <select
+                                                        value={symptomTiming[s.id]?.onset || ""}
+                                                        onChange={(e) => changeTiming(s.id, "onset", e.target.value)}
+                                                        className="pi-select"
+                                                    >
+                                                        <option value="">Inicio —</option>
+                                                        <option value="subito">Súbito</option>
+                                                        <option value="gradual">Gradual</option>
+                                                    </select>
+                                                    <input
+                                                        type="number"
+                                                        min="0"
+                                                        placeholder="Días"
+                                                        value={symptomTiming[s.id]?.durationDays ?? ""}
+                                                        onChange={(e) => changeTiming(s.id, "durationDays", e.target.value)}
+                                                        className="pi-select"
+                                                        style={{ width: 80 }}
+                                                    />
+                                                    <input
+                                                        type="number"
+                                                        min="0"
+                                                        max="10"
+                                                        step="0.5"
+                                                        placeholder="Intensidad 0–10"
+                                                        value={symptomTiming[s.id]?.intensity ?? ""}
+                                                        onChange={(e) => changeTiming(s.id, "intensity", e.target.value)}
+                                                        className="pi-select"
+                                                        style={{ width: 130 }}
+                                                    />
+                                                </div>
+                                            )}
                                         </div>
                                     );
                                 })}
@@ -348,6 +458,65 @@ export default function PatientIntakeAndDiagnosis() {
                     <div className="pi-card">
                         <h2 className="pi-title">Alergias y Condiciones</h2>
 
+                        {patients.length > 0 && (
+                            <div className="pi-row" style={{ marginBottom: 12 }}>
+                                <span className="pi-muted" style={{ fontSize: 12 }}>Paciente:</span>
+                                <select value={patientId} onChange={(e) => setPatientId(e.target.value)} className="pi-select">
+                                    <option value="">Sin ficha</option>
+                                    {patients.map((p) => (
+                                        <option key={p.id} value={p.id}>{p.name}</option>
+                                    ))}
+                                </select>
+                                {patientId && <span className="pi-muted" style={{ fontSize: 12 }}>Se suman sus alergias, crónicas y medicación registradas.</span>}
+                            </div>
+                        )}
+
+                        <div style={{ display: "flex", gap: 12, flexWrap: "wrap", marginBottom: 16 }}>
+                            {[
+                                ["ageYears", "Edad (años)"],
+                                ["weightKg", "Peso (kg)"],
+                                ["creatinineClearance", "Aclaramiento de creatinina (mL/min)"],
+                            ].map(([key, label]) => (
+                                <label key={key} className="pi-muted" style={{ fontSize: 13, display: "grid", gap: 4 }}>
+                                    {label}
+                                    <input
+                                        type="number"
+                                        min="0"
+                                        value={demographics[key]}
+                                        onChange={(e) => setDemographics({ ...demographics, [key]: e.target.value })}
+                                    />
+                                </label>
+                            ))}
+                            <label className="pi-muted" style={{ fontSize: 13, display: "grid", gap: 4 }}>
+                                Sexo
+                                <select value={demographics.sex} onChange={(e) => setDemographics({ ...demographics, sex: e.target.value })}>
+                                    <option value="">—</option>
+                                    <option value="femenino">Femenino</option>
+                                    <option value="masculino">Masculino</option>
+                                </select>
+                            </label>
+                            <label className="pi-row" style={{ fontSize: 14, cursor: "pointer" }}>
+                                <input
+                                    type="checkbox"
+                                    checked={demographics.pregnant}
+                                    onChange={() => setDemographics({ ...demographics, pregnant: !demographics.pregnant })}
+                                />
+                                Embarazo
+                            </label>
+                            {RISK_FACTORS.map((f) => (
+                                <label key={f.value} className="pi-row" style={{ fontSize: 14, cursor: "pointer" }}>
+                                    <input
+                                        type="checkbox"
+                                        checked={demographics.riskFactors.includes(f.value)}
+                                        onChange={() =>
+                                            toggleFromList(f.value, demographics.riskFactors, (list) => setDemographics({ ...demographics, riskFactors: list }))
+                                        }
+                                    />
+                                    {f.label}
+                                </label>
+                            ))}
+                        </div>
+
                         <div style={{ marginBottom: 16 }}>
                             <div className="pi-muted" style={{ fontSize: 13, marginBottom: 6 }}>
                                 Alergias a medicamentos
@@ -370,6 +539,28 @@ export default function PatientIntakeAndDiagnosis() {
                             </div>
                         </div>
 
+                        <div style={{ marginBottom: 16 }}>
+                            <div className="pi-muted" style={{ fontSize: 13, marginBottom: 6 }}>
+                                Medicamentos que toma actualmente
+                            </div>
+                            <div className="pi-list">
+                                {medications.length === 0 ? (
+                                    <div className="pi-skeleton" />
+                                ) : (
+                                    medications.map((m) => (
+                                        <label key={m.id} className="pi-row" style={{ padding: "4px 0", cursor: "pointer" }}>
+                                            <input
+                                                type="checkbox"
+                                                checked={selectedCurrentMeds.includes(m.id)}
+                                                onChange={() => toggleFromList(m.id, selectedCurrentMeds, setSelectedCurrentMeds)}
+                                            />
+                                            <span style={{ fontSize: 14 }}>{m.name}</span>
+                                        </label>
+                                    ))
+                                )}
+                            </div>
+                        </div>
+
                         <div>
                             <div className="pi-muted" style={{ fontSize: 13, marginBottom: 6 }}>
                                 Enfermedades crónicas
@@ -401,10 +592,16 @@ export default function PatientIntakeAndDiagnosis() {
                     <button
                         onClick={() => {
                             setSelectedSymptoms({});
+                            setSymptomTiming({});
                             setSelectedAllergies([]);
                             setSelectedChronics([]);
+                            setSelectedCurrentMeds([]);
+                            setDemographics(EMPTY_DEMOGRAPHICS);
                             setResults([]);
                             setRulesGlobal("");
+                            setConfidence(null);
+                            setFollowUp([]);
+                            setProvenance(null);
                             setGeneratedAt(null);
                         }}
                         className="pi-btn secondary"
@@ -435,6 +632,43 @@ export default function PatientIntakeAndDiagnosis() {
                         <p className="pi-muted">Aún no hay resultados. Completa el formulario y solicita el análisis.</p>
                     ) : (
                         <div style={{ display: "grid", gap: 24 }}>
+                            {confidence && (
+                                <p className="pi-muted" style={{ margin: 0 }}>
+                                    {results.length} de {confidence.total} enfermedades comparten algún síntoma.
+                                    {confidence.kbVersion > 0 && ` Base de conocimiento v${confidence.kbVersion}.`}
+                                    {confidence.ambiguous && (
+                                        <span className="pi-badge badge-urgent" style={{ marginLeft: 8 }}>
+                                            Resultado ambiguo: los primeros candidatos están a {Math.round((confidence.gap || 0) * 100)} puntos
+                                        </span>
+                                    )}
+                                </p>
+                            )}
+                            {provenance && (
+                                <p className="pi-muted" style={{ margin: 0, fontSize: 12 }}>
+                                    De la ficha:{" "}
+                                    {[
+                                        ...provenance.fromProfile.allergies,
+                                        ...provenance.fromProfile.chronics,
+                                        ...provenance.fromProfile.currentMedications,
+                                        ...provenance.fromProfile.demographics,
+                                    ]
+                                        .map(prettify)
+                                        .join(", ") || "nada"}
+                                </p>
+                            )}
+                            {followUp.length > 0 && (
+                                <div>
+                                    <h3 style={{ fontSize: 14, margin: "0 0 8px" }}>Para afinar el resultado</h3>
+                                    {followUp.map((q) => (
+                                        <div key={q.symptomId} className="pi-row">
+                                            <span>¿Presenta {prettify(q.symptomId)}?</span>
+                                            <button className="pi-btn secondary" onClick={() => answerFollowUp(q.symptomId, true)}>Sí</button>
+                                            <button className="pi-btn secondary" onClick={() => answerFollowUp(q.symptomId, false)}>No</button>
+                                        </div>
+                                    ))}
+                                    <p className="pi-muted" style={{ fontSize: 12 }}>Responde y vuelve a analizar.</p>
+                                </div>
+                            )}
                             <div style={{ overflowX: "auto" }}>
                                 <table className="pi-table">
                                     <thead>
@@ -451,7 +685,14 @@ export default function PatientIntakeAndDiagnosis() {
                                         <tr key={i}>
                                             <td style={{ fontWeight: 600 }}>{r.diseaseName}</td>
                                             <td>{Math.round((r.affinity || 0) * 100)}%</td>
-                                            <td>{r?.medication?.name || "—"}</td>
+                                            <td>
+                                                {r?.medication?.name || "—"}
+                                                {r?.alternatives?.length > 1 && (
+                                                    <div className="pi-muted" style={{ fontSize: 12 }}>
+                                                        {r.alternatives.map((a) => `${a.line}ª línea: ${a.name}${a.safe ? "" : ` (excluido: ${a.excludedBy})`}`).join(" · ")}
+                                                    </div>
+                                                )}
+                                            </td>
                                             <td>{urgencyBadge(r?.urgency)}</td>
                                             <td>
                                                 {r?.conflicts?.length > 0 ? (